@@ -0,0 +1,125 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"go.farcloser.world/tigron/internal/assertive"
+	"go.farcloser.world/tigron/test"
+)
+
+// BytesEquals is to be used for expected.OutputStream to ensure the output is exactly the provided
+// bytes. On mismatch, the offset of the first differing byte is reported.
+func BytesEquals(compare []byte) test.StreamComparator {
+	//nolint:thelper
+	return func(stdout io.Reader, info string, t *testing.T) {
+		t.Helper()
+
+		var (
+			offset   int64
+			mismatch int64 = -1
+		)
+
+		buf := make([]byte, streamBufferSize)
+
+		for {
+			read, err := stdout.Read(buf)
+			if read > 0 && mismatch < 0 {
+				expected := compare[min(offset, int64(len(compare))):]
+				expected = expected[:min(read, len(expected))]
+
+				for index := range read {
+					if index >= len(expected) || buf[index] != expected[index] {
+						mismatch = offset + int64(index)
+
+						break
+					}
+				}
+			}
+
+			offset += int64(read)
+
+			if err != nil {
+				break
+			}
+		}
+
+		if mismatch < 0 && offset < int64(len(compare)) {
+			mismatch = offset
+		}
+
+		assertive.Check(t, mismatch < 0,
+			fmt.Sprintf(
+				"Output differs from expected bytes at offset %d (expected length: %d, actual length: %d)",
+				mismatch,
+				len(compare),
+				offset,
+			)+info)
+	}
+}
+
+// BytesHasPrefix is to be used for expected.OutputStream to ensure the output starts with the
+// provided bytes (typically a magic number identifying a file format).
+func BytesHasPrefix(prefix []byte) test.StreamComparator {
+	//nolint:thelper
+	return func(stdout io.Reader, info string, t *testing.T) {
+		t.Helper()
+
+		head := make([]byte, len(prefix))
+		read, _ := io.ReadFull(stdout, head)
+
+		assertive.Check(t, bytes.Equal(head[:read], prefix),
+			fmt.Sprintf("Output does not start with: %x (starts with: %x)", prefix, head[:read])+info)
+	}
+}
+
+// BytesLength is to be used for expected.OutputStream to ensure the output is exactly length bytes
+// long.
+func BytesLength(length int64) test.StreamComparator {
+	//nolint:thelper
+	return func(stdout io.Reader, info string, t *testing.T) {
+		t.Helper()
+
+		actual, err := io.Copy(io.Discard, stdout)
+
+		assertive.Check(t, err == nil && actual == length,
+			fmt.Sprintf("Output length is not: %d (actual: %d)", length, actual)+info)
+	}
+}
+
+// SHA256 is to be used for expected.OutputStream to ensure the sha256 checksum of the output is the
+// provided (hex encoded) digest.
+func SHA256(digest string) test.StreamComparator {
+	//nolint:thelper
+	return func(stdout io.Reader, info string, t *testing.T) {
+		t.Helper()
+
+		hash := sha256.New()
+		_, err := io.Copy(hash, stdout)
+		actual := hex.EncodeToString(hash.Sum(nil))
+
+		assertive.Check(t, err == nil && actual == strings.ToLower(digest),
+			fmt.Sprintf("Output sha256 is not: %s (actual: %s)", digest, actual)+info)
+	}
+}
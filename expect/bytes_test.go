@@ -0,0 +1,48 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+package expect_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"testing/iotest"
+
+	"go.farcloser.world/tigron/expect"
+)
+
+func TestExpectBytes(t *testing.T) {
+	t.Parallel()
+
+	// A gzip header, followed by some binary content
+	content := append([]byte{0x1f, 0x8b, 0x08, 0x00}, bytes.Repeat([]byte{0x00, 0xff, 0x0a}, 50000)...)
+	sum := sha256.Sum256(content)
+
+	expect.BytesEquals(content)(iotest.HalfReader(bytes.NewReader(content)), "info", t)
+	expect.BytesHasPrefix([]byte{0x1f, 0x8b})(bytes.NewReader(content), "info", t)
+	expect.BytesLength(int64(len(content)))(bytes.NewReader(content), "info", t)
+	expect.SHA256(hex.EncodeToString(sum[:]))(bytes.NewReader(content), "info", t)
+
+	expect.AllStreams(
+		expect.BytesEquals(content),
+		expect.BytesHasPrefix([]byte{0x1f, 0x8b}),
+		expect.BytesLength(int64(len(content))),
+		expect.SHA256(hex.EncodeToString(sum[:])),
+	)(bytes.NewReader(content), "info", t)
+}
@@ -0,0 +1,208 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContext = 3
+	// diffMaxCells bounds the size of the table used to compute differences. Past that, changed
+	// regions are reported as entirely removed and added.
+	diffMaxCells = 1 << 22
+)
+
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff returns the differences between from and to, line by line, in unified format (empty
+// if they are equal).
+func unifiedDiff(fromName, toName, from, to string) string {
+	if from == to {
+		return ""
+	}
+
+	ops := diffLines(splitLines(from), splitLines(to))
+
+	changes := []int{}
+
+	for index, op := range ops {
+		if op.kind != ' ' {
+			changes = append(changes, index)
+		}
+	}
+
+	if len(changes) == 0 {
+		return "(only the final new line differs)\n"
+	}
+
+	var builder strings.Builder
+
+	builder.WriteString("--- " + fromName + "\n+++ " + toName + "\n")
+
+	for first := 0; first < len(changes); {
+		// Extend the hunk as long as changes are close enough to share context
+		last := first
+		for last+1 < len(changes) && changes[last+1]-changes[last] <= 2*diffContext {
+			last++
+		}
+
+		start := max(changes[first]-diffContext, 0)
+		end := min(changes[last]+diffContext+1, len(ops))
+
+		writeHunk(&builder, ops, start, end)
+
+		first = last + 1
+	}
+
+	return builder.String()
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+func writeHunk(builder *strings.Builder, ops []diffOp, start, end int) {
+	// Line numbers (starting at one) of the hunk in both versions
+	fromLine, toLine := 1, 1
+
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			fromLine++
+		}
+
+		if op.kind != '-' {
+			toLine++
+		}
+	}
+
+	fromCount, toCount := 0, 0
+
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			fromCount++
+		}
+
+		if op.kind != '-' {
+			toCount++
+		}
+	}
+
+	// Empty ranges point at the line before
+	if fromCount == 0 {
+		fromLine--
+	}
+
+	if toCount == 0 {
+		toLine--
+	}
+
+	fmt.Fprintf(builder, "@@ -%d,%d +%d,%d @@\n", fromLine, fromCount, toLine, toCount)
+
+	for _, op := range ops[start:end] {
+		builder.WriteByte(op.kind)
+		builder.WriteString(op.text + "\n")
+	}
+}
+
+// diffLines computes the edit script turning from into to, as the longest common subsequence of
+// their lines.
+func diffLines(from, to []string) []diffOp {
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix &&
+		from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(from)+len(to))
+
+	for _, line := range from[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	fromMiddle := from[prefix : len(from)-suffix]
+	toMiddle := to[prefix : len(to)-suffix]
+
+	if len(fromMiddle)*len(toMiddle) > diffMaxCells {
+		for _, line := range fromMiddle {
+			ops = append(ops, diffOp{'-', line})
+		}
+
+		for _, line := range toMiddle {
+			ops = append(ops, diffOp{'+', line})
+		}
+	} else {
+		ops = append(ops, diffCommon(fromMiddle, toMiddle)...)
+	}
+
+	for _, line := range from[len(from)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	return ops
+}
+
+func diffCommon(from, to []string) []diffOp {
+	// common[i][j] is the length of the longest common subsequence of from[i:] and to[j:]
+	common := make([][]int, len(from)+1)
+	for index := range common {
+		common[index] = make([]int, len(to)+1)
+	}
+
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	ops := []diffOp{}
+	i, j := 0, 0
+
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			ops = append(ops, diffOp{' ', from[i]})
+			i++
+			j++
+		case i < len(from) && (j == len(to) || common[i+1][j] >= common[i][j+1]):
+			ops = append(ops, diffOp{'-', from[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', to[j]})
+			j++
+		}
+	}
+
+	return ops
+}
@@ -28,5 +28,6 @@ const (
 	ExitCodeTimeout = -12
 	// ExitCodeSignaled verifies that the command has been terminated by a signal.
 	ExitCodeSignaled = -13
-	// ExitCodeCancelled = -14.
+	// ExitCodeCancelled verifies that the command was cancelled through its context.
+	ExitCodeCancelled = -14
 )
@@ -0,0 +1,125 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.farcloser.world/tigron/internal/assertive"
+	"go.farcloser.world/tigron/test"
+)
+
+const (
+	// GoldenUpdateEnv is the environment variable that, if set (to anything), makes Golden rewrite
+	// golden files with the actual output instead of comparing.
+	// This is not a command-line flag (like the usual `-update`), as a library registering one would
+	// clash with test packages defining their own, and as `go test ./...` rejects flags that some of
+	// the packages do not define.
+	GoldenUpdateEnv = "TIGRON_GOLDEN_UPDATE"
+
+	goldenDir       = "testdata"
+	goldenExtension = ".golden"
+	goldenDirPerm   = 0o755
+	goldenFilePerm  = 0o644
+)
+
+// Golden can be used as a parameter for expected.Output to ensure the output is exactly the content
+// of the golden file named after the test (testdata/<test name>.golden, relative to the package
+// being tested). If name is provided, it is appended to the file name, as in
+// testdata/<test name>-<name>.golden, so that a test can compare several outputs.
+// Running tests with TIGRON_GOLDEN_UPDATE=1 (re)writes golden files instead.
+// Values that change from one run to another can be stored as placeholders: in the output,
+// occurrences of the test Identifier() and TempDir() are replaced by {{identifier}} and {{tempdir}}
+// (if data is not nil), and occurrences of the values of placeholders by {{<key>}}.
+// Mismatches are reported as a unified diff.
+func Golden(data test.Data, placeholders map[string]string, name ...string) test.Comparator {
+	//nolint:thelper
+	return func(stdout, info string, t *testing.T) {
+		t.Helper()
+
+		if !assertive.Check(t, t.Name() != "", "Golden files require a named test"+info) {
+			return
+		}
+
+		file := strings.Join(append([]string{t.Name()}, name...), "-")
+		path := filepath.Join(goldenDir, filepath.FromSlash(file)+goldenExtension)
+		actual := withPlaceholders(stdout, data, placeholders)
+
+		if os.Getenv(GoldenUpdateEnv) != "" {
+			err := os.MkdirAll(filepath.Dir(path), goldenDirPerm)
+			if err == nil {
+				err = os.WriteFile(path, []byte(actual), goldenFilePerm)
+			}
+
+			if assertive.Check(t, err == nil, fmt.Sprintf("Failed writing golden file %s: %v", path, err)+info) {
+				t.Log("Updated golden file " + path)
+			}
+
+			return
+		}
+
+		expected, err := os.ReadFile(path)
+		if !assertive.Check(t, err == nil,
+			fmt.Sprintf("Failed reading golden file %s (run with %s=1 to create it): %v", path, GoldenUpdateEnv, err)+
+				info) {
+			return
+		}
+
+		assertive.Check(t, string(expected) == actual,
+			fmt.Sprintf("Output differs from golden file %s (run with %s=1 to update it):\n%s",
+				path, GoldenUpdateEnv, unifiedDiff(path, "output", string(expected), actual))+info)
+	}
+}
+
+// withPlaceholders replaces values in output with their placeholders, longest values first.
+func withPlaceholders(output string, data test.Data, placeholders map[string]string) string {
+	names := map[string]string{}
+
+	for key, value := range placeholders {
+		names[value] = key
+	}
+
+	if data != nil {
+		names[data.TempDir()] = "tempdir"
+		names[data.Identifier()] = "identifier"
+	}
+
+	values := []string{}
+
+	for value := range names {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	slices.SortFunc(values, func(a, b string) int {
+		return cmp.Or(len(b)-len(a), strings.Compare(a, b))
+	})
+
+	replacements := []string{}
+	for _, value := range values {
+		replacements = append(replacements, value, "{{"+names[value]+"}}")
+	}
+
+	return strings.NewReplacer(replacements...).Replace(output)
+}
@@ -0,0 +1,55 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+package expect_test
+
+import (
+	"testing"
+
+	"go.farcloser.world/tigron/expect"
+	"go.farcloser.world/tigron/test"
+)
+
+type goldenData struct {
+	test.Data
+
+	tempDir string
+}
+
+func (data *goldenData) Identifier(_ ...string) string {
+	return "golden-identifier"
+}
+
+func (data *goldenData) TempDir() string {
+	return data.tempDir
+}
+
+func TestExpectGolden(t *testing.T) {
+	t.Parallel()
+
+	data := &goldenData{tempDir: t.TempDir()}
+	output := "Usage: tigron [flags]\n\nWorking in " + data.tempDir + " as golden-identifier, with alpine:3\n"
+
+	expect.Golden(data, map[string]string{"image": "alpine:3"})(output, "info", t)
+}
+
+func TestExpectGoldenNamed(t *testing.T) {
+	t.Parallel()
+
+	expect.Golden(nil, nil, "first")("first output\n", "info", t)
+	expect.Golden(nil, nil, "second")("second output\n", "info", t)
+}
@@ -0,0 +1,508 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/big"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.farcloser.world/tigron/internal/assertive"
+	"go.farcloser.world/tigron/test"
+)
+
+var (
+	errInvalidPath      = errors.New("invalid json path")
+	errSeveralDocuments = errors.New("found more than one json document (see JSONLines)")
+
+	identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+)
+
+// JSONCheck verifies a decoded JSON document - see JSON and JSONLines.
+type JSONCheck func(document any, info string, t *testing.T)
+
+// JSON can be used as a parameter for expected.Output to parse the output as a single JSON
+// document, then run the provided checks against it.
+// Checks address values with a path, in a simplified JSONPath syntax: `$` is the whole document,
+// `.key` or `["key"]` an object member, and `[index]` an array element (negative indexes count from
+// the end). For example: `$.items[0].name`.
+func JSON(checks ...JSONCheck) test.Comparator {
+	//nolint:thelper
+	return func(stdout, info string, t *testing.T) {
+		t.Helper()
+
+		documents, err := decodeJSON(stdout)
+		if err == nil && len(documents) == 0 {
+			err = io.ErrUnexpectedEOF
+		} else if err == nil && len(documents) > 1 {
+			err = errSeveralDocuments
+		}
+
+		if !assertive.Check(t, err == nil, fmt.Sprintf("Output is not a JSON document: %v", err)+info) {
+			return
+		}
+
+		for _, check := range checks {
+			check(documents[0], info, t)
+		}
+	}
+}
+
+// JSONLines can be used as a parameter for expected.Output to parse the output as a sequence of
+// JSON documents (typically one per line), then run the provided checks against them, presented as
+// an array (eg: `$[0].name` is the name member of the first document). Empty output is an empty
+// array.
+func JSONLines(checks ...JSONCheck) test.Comparator {
+	//nolint:thelper
+	return func(stdout, info string, t *testing.T) {
+		t.Helper()
+
+		documents, err := decodeJSON(stdout)
+		if !assertive.Check(t, err == nil, fmt.Sprintf("Output is not a sequence of JSON documents: %v", err)+info) {
+			return
+		}
+
+		for _, check := range checks {
+			check(documents, info, t)
+		}
+	}
+}
+
+// JSONEquals ensures the value at path is equal to expected, which can be anything that encodes to
+// JSON (a string, a number, a map, a struct, etc). Mismatches are reported path by path.
+func JSONEquals(path string, expected any) JSONCheck {
+	return jsonCompare(path, expected, false)
+}
+
+// JSONSubset ensures the value at path contains expected: objects must have (at least) the expected
+// members, arrays must have, for every expected element, a distinct matching element, and other
+// values must be equal.
+func JSONSubset(path string, expected any) JSONCheck {
+	return jsonCompare(path, expected, true)
+}
+
+// JSONExists ensures there is a value at path (possibly null).
+func JSONExists(path string) JSONCheck {
+	//nolint:thelper
+	return func(document any, info string, t *testing.T) {
+		t.Helper()
+
+		_, found, err := jsonLookup(document, path)
+		assertive.Check(t, err == nil && found, fmt.Sprintf("JSON has no value at %s%s", path, errOrEmpty(err))+info)
+	}
+}
+
+// JSONDoesNotExist ensures there is no value at path.
+func JSONDoesNotExist(path string) JSONCheck {
+	//nolint:thelper
+	return func(document any, info string, t *testing.T) {
+		t.Helper()
+
+		value, found, err := jsonLookup(document, path)
+		assertive.Check(t, err == nil && !found,
+			fmt.Sprintf("JSON should have no value at %s (found: %s)%s", path, jsonString(value), errOrEmpty(err))+
+				info)
+	}
+}
+
+// JSONType ensures the value at path is of the given kind: "object", "array", "string", "number",
+// "boolean" or "null".
+func JSONType(path, kind string) JSONCheck {
+	//nolint:thelper
+	return func(document any, info string, t *testing.T) {
+		t.Helper()
+
+		value, found, err := jsonLookup(document, path)
+		if !checkFound(t, path, found, err, info) {
+			return
+		}
+
+		assertive.Check(t, jsonKind(value) == kind,
+			fmt.Sprintf("JSON value at %s is not of type %s (actual: %s)", path, kind, jsonKind(value))+info)
+	}
+}
+
+// JSONLength ensures the array (or object) at path has length elements (or members).
+func JSONLength(path string, length int) JSONCheck {
+	//nolint:thelper
+	return func(document any, info string, t *testing.T) {
+		t.Helper()
+
+		value, found, err := jsonLookup(document, path)
+		if !checkFound(t, path, found, err, info) {
+			return
+		}
+
+		actual := -1
+
+		switch typed := value.(type) {
+		case []any:
+			actual = len(typed)
+		case map[string]any:
+			actual = len(typed)
+		}
+
+		assertive.Check(t, actual == length,
+			fmt.Sprintf("JSON value at %s does not have length %d (actual: %d, %s)",
+				path, length, actual, jsonKind(value))+info)
+	}
+}
+
+func jsonCompare(path string, expected any, subset bool) JSONCheck {
+	//nolint:thelper
+	return func(document any, info string, t *testing.T) {
+		t.Helper()
+
+		value, found, err := jsonLookup(document, path)
+		if !checkFound(t, path, found, err, info) {
+			return
+		}
+
+		normalized, err := normalizeJSON(expected)
+		if !assertive.Check(t, err == nil, fmt.Sprintf("Expected value cannot be encoded to JSON: %v", err)+info) {
+			return
+		}
+
+		diff := jsonDiff(strings.TrimSpace(path), normalized, value, subset)
+		assertive.Check(t, len(diff) == 0,
+			fmt.Sprintf("JSON value at %s differs from expected:\n\t%s", path, strings.Join(diff, "\n\t"))+info)
+	}
+}
+
+//nolint:thelper
+func checkFound(t *testing.T, path string, found bool, err error, info string) bool {
+	t.Helper()
+
+	return assertive.Check(t, err == nil && found,
+		fmt.Sprintf("JSON has no value at %s%s", path, errOrEmpty(err))+info)
+}
+
+func errOrEmpty(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return " (" + err.Error() + ")"
+}
+
+// decodeJSON decodes all the documents found in the output (none if it is empty).
+func decodeJSON(output string) ([]any, error) {
+	decoder := json.NewDecoder(strings.NewReader(output))
+	decoder.UseNumber()
+
+	documents := []any{}
+
+	for {
+		var document any
+
+		err := decoder.Decode(&document)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			//nolint:wrapcheck
+			return nil, err
+		}
+
+		documents = append(documents, document)
+	}
+
+	return documents, nil
+}
+
+// normalizeJSON turns any value into what decoding its JSON representation would give.
+func normalizeJSON(value any) (any, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		//nolint:wrapcheck
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(encoded)))
+	decoder.UseNumber()
+
+	var normalized any
+
+	//nolint:wrapcheck
+	return normalized, decoder.Decode(&normalized)
+}
+
+// jsonLookup returns the value at path in document, and whether it was found.
+func jsonLookup(document any, path string) (any, bool, error) {
+	rest := strings.TrimSpace(path)
+	if !strings.HasPrefix(rest, "$") {
+		return nil, false, fmt.Errorf("%w: %q should start with $", errInvalidPath, path)
+	}
+
+	rest = rest[1:]
+	value := document
+
+	for rest != "" {
+		var (
+			key   string
+			index int
+			isKey bool
+			err   error
+		)
+
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+
+			key, isKey, rest = rest[1:end], true, rest[end:]
+		case strings.HasPrefix(rest, `["`):
+			end := strings.Index(rest, `"]`)
+			if end < 0 {
+				return nil, false, fmt.Errorf("%w: unterminated key in %q", errInvalidPath, path)
+			}
+
+			key, isKey, rest = rest[2:end], true, rest[end+2:]
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, false, fmt.Errorf("%w: unterminated index in %q", errInvalidPath, path)
+			}
+
+			if index, err = strconv.Atoi(rest[1:end]); err != nil {
+				return nil, false, fmt.Errorf("%w: invalid index in %q", errInvalidPath, path)
+			}
+
+			rest = rest[end+1:]
+		default:
+			return nil, false, fmt.Errorf("%w: unexpected %q in %q", errInvalidPath, rest, path)
+		}
+
+		if isKey {
+			object, ok := value.(map[string]any)
+			if !ok {
+				return nil, false, nil
+			}
+
+			if value, ok = object[key]; !ok {
+				return nil, false, nil
+			}
+
+			continue
+		}
+
+		array, ok := value.([]any)
+		if !ok {
+			return nil, false, nil
+		}
+
+		if index < 0 {
+			index += len(array)
+		}
+
+		if index < 0 || index >= len(array) {
+			return nil, false, nil
+		}
+
+		value = array[index]
+	}
+
+	return value, true, nil
+}
+
+// jsonDiff lists the differences between expected and actual, one line per path.
+func jsonDiff(path string, expected, actual any, subset bool) []string {
+	switch typed := expected.(type) {
+	case map[string]any:
+		object, ok := actual.(map[string]any)
+		if !ok {
+			break
+		}
+
+		diff := []string{}
+
+		for _, key := range slices.Sorted(maps.Keys(typed)) {
+			value, found := object[key]
+			if !found {
+				diff = append(diff,
+					fmt.Sprintf("%s: missing (expected: %s)", jsonChild(path, key), jsonString(typed[key])))
+
+				continue
+			}
+
+			diff = append(diff, jsonDiff(jsonChild(path, key), typed[key], value, subset)...)
+		}
+
+		if !subset {
+			for _, key := range slices.Sorted(maps.Keys(object)) {
+				if _, found := typed[key]; !found {
+					diff = append(diff,
+						fmt.Sprintf("%s: unexpected (actual: %s)", jsonChild(path, key), jsonString(object[key])))
+				}
+			}
+		}
+
+		return diff
+	case []any:
+		array, ok := actual.([]any)
+		if !ok {
+			break
+		}
+
+		diff := []string{}
+
+		if subset {
+			for _, index := range jsonUnmatched(path, typed, array) {
+				diff = append(diff,
+					fmt.Sprintf("%s[%d]: no matching element (expected: %s)", path, index, jsonString(typed[index])))
+			}
+
+			return diff
+		}
+
+		if len(typed) != len(array) {
+			diff = append(diff, fmt.Sprintf("%s: expected %d elements, got %d", path, len(typed), len(array)))
+		}
+
+		for index := range min(len(typed), len(array)) {
+			diff = append(diff, jsonDiff(fmt.Sprintf("%s[%d]", path, index), typed[index], array[index], subset)...)
+		}
+
+		return diff
+	case json.Number:
+		if number, ok := actual.(json.Number); ok && jsonNumberEqual(typed, number) {
+			return nil
+		}
+	default:
+		if jsonKind(expected) == jsonKind(actual) && expected == actual {
+			return nil
+		}
+	}
+
+	return []string{fmt.Sprintf("%s: expected %s, got %s", path, jsonString(expected), jsonString(actual))}
+}
+
+// jsonUnmatched pairs every expected element with a distinct matching actual element, and returns
+// the indexes of the expected elements left without one. Elements are paired as a bipartite
+// matching, so that an element matching several others does not get in the way.
+func jsonUnmatched(path string, expected, actual []any) []int {
+	candidates := make([][]int, len(expected))
+
+	for index, element := range expected {
+		for position, candidate := range actual {
+			if len(jsonDiff(path, element, candidate, true)) == 0 {
+				candidates[index] = append(candidates[index], position)
+			}
+		}
+	}
+
+	// owners holds, for every actual element, the expected element it is paired with (or -1)
+	owners := make([]int, len(actual))
+	for position := range owners {
+		owners[position] = -1
+	}
+
+	var pair func(index int, visited []bool) bool
+
+	pair = func(index int, visited []bool) bool {
+		for _, position := range candidates[index] {
+			if visited[position] {
+				continue
+			}
+
+			visited[position] = true
+
+			// Take it if it is free, or if its owner can be paired with another one
+			if owners[position] < 0 || pair(owners[position], visited) {
+				owners[position] = index
+
+				return true
+			}
+		}
+
+		return false
+	}
+
+	unmatched := []int{}
+
+	for index := range expected {
+		if !pair(index, make([]bool, len(actual))) {
+			unmatched = append(unmatched, index)
+		}
+	}
+
+	return unmatched
+}
+
+func jsonNumberEqual(one, two json.Number) bool {
+	if one == two {
+		return true
+	}
+
+	// Integers are compared exactly, as float64 cannot represent all of them
+	firstInt, ok1 := new(big.Int).SetString(one.String(), 10)
+	secondInt, ok2 := new(big.Int).SetString(two.String(), 10)
+
+	if ok1 && ok2 {
+		return firstInt.Cmp(secondInt) == 0
+	}
+
+	first, err1 := one.Float64()
+	second, err2 := two.Float64()
+
+	return err1 == nil && err2 == nil && first == second
+}
+
+func jsonChild(path, key string) string {
+	if identifier.MatchString(key) {
+		return path + "." + key
+	}
+
+	return path + `[` + strconv.Quote(key) + `]`
+}
+
+func jsonKind(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case json.Number, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func jsonString(value any) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(encoded)
+}
@@ -0,0 +1,53 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+//nolint:testpackage // We need to test some internals here
+package expect
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.farcloser.world/tigron/internal/assertive"
+)
+
+func TestDecodeJSONEmpty(t *testing.T) {
+	t.Parallel()
+
+	documents, err := decodeJSON(" \n\t\n")
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, len(documents), 0)
+}
+
+func TestJSONNumberEqual(t *testing.T) {
+	t.Parallel()
+
+	assertive.True(t, jsonNumberEqual("1", "1.0"))
+	assertive.True(t, jsonNumberEqual("1000", "1e3"))
+	// Both would be the same float64
+	assertive.True(t, !jsonNumberEqual("9007199254740993", "9007199254740992"),
+		"large integers should be compared exactly")
+}
+
+func TestJSONDiffSubsetArrays(t *testing.T) {
+	t.Parallel()
+
+	diff := jsonDiff("$", []any{json.Number("1"), json.Number("1")}, []any{json.Number("1")}, true)
+
+	assertive.IsEqual(t, len(diff), 1, "a single element should not match several expected ones")
+}
@@ -0,0 +1,96 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+package expect_test
+
+import (
+	"testing"
+
+	"go.farcloser.world/tigron/expect"
+)
+
+func TestExpectJSON(t *testing.T) {
+	t.Parallel()
+
+	output := `{
+	"name": "tigron",
+	"version": 1.0,
+	"tags": ["test", "go"],
+	"items": [{"id": 1, "name": "one", "extra": true}, {"id": 2, "name": "two"}],
+	"weird key": null
+}`
+
+	expect.JSON(
+		expect.JSONEquals("$.name", "tigron"),
+		expect.JSONEquals("$.version", 1),
+		expect.JSONEquals("$.items[1]", map[string]any{"id": 2, "name": "two"}),
+		expect.JSONEquals("$.items[-1].name", "two"),
+		expect.JSONSubset("$", map[string]any{
+			"tags":  []string{"go"},
+			"items": []any{map[string]any{"id": 1}},
+		}),
+		expect.JSONExists(`$["weird key"]`),
+		expect.JSONDoesNotExist("$.items[2]"),
+		expect.JSONDoesNotExist("$.name.first"),
+		expect.JSONType("$.items", "array"),
+		expect.JSONType("$.items[0].extra", "boolean"),
+		expect.JSONType(`$["weird key"]`, "null"),
+		expect.JSONLength("$.tags", 2),
+		expect.JSONLength("$.items[0]", 3),
+	)(output, "info", t)
+}
+
+func TestExpectJSONLines(t *testing.T) {
+	t.Parallel()
+
+	output := `{"level": "info", "msg": "starting"}
+{"level": "error", "msg": "failed", "code": 42}
+`
+
+	expect.JSONLines(
+		expect.JSONLength("$", 2),
+		expect.JSONEquals("$[1].code", 42),
+		expect.JSONSubset("$", []any{map[string]any{"level": "error"}}),
+	)(output, "info", t)
+}
+
+func TestExpectJSONEmpty(t *testing.T) {
+	t.Parallel()
+
+	expect.JSONLines(expect.JSONLength("$", 0))("", "info", t)
+	expect.JSONLines(expect.JSONEquals("$", []any{}))(" \n\t\n", "info", t)
+}
+
+func TestExpectJSONNumbers(t *testing.T) {
+	t.Parallel()
+
+	expect.JSON(
+		expect.JSONEquals("$[0]", 9007199254740993),
+		expect.JSONEquals("$[1]", 1),
+		expect.JSONEquals("$[2]", 1e3),
+	)("[9007199254740993, 1.0, 1000]", "info", t)
+}
+
+func TestExpectJSONSubsetArrays(t *testing.T) {
+	t.Parallel()
+
+	// Every expected element needs its own match, whatever the order
+	expect.JSON(
+		expect.JSONSubset("$", []any{1, 1}),
+		expect.JSONSubset("$", []any{map[string]any{"a": 1}, map[string]any{"a": 1, "b": 2}}),
+	)(`[{"a": 1, "b": 2}, 1, {"a": 1}, 1]`, "info", t)
+}
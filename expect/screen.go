@@ -0,0 +1,129 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.farcloser.world/tigron/internal/assertive"
+	"go.farcloser.world/tigron/internal/vt"
+	"go.farcloser.world/tigron/test"
+)
+
+// TerminalScreen is the rendered output of a command, as a terminal of a given size would display
+// it. Rows and columns start at zero.
+type TerminalScreen interface {
+	// Row returns the text of a row, without trailing blanks.
+	Row(row int) string
+	// Cell returns the character at a position.
+	Cell(row, col int) rune
+	// Cursor returns the position of the cursor.
+	Cursor() (row, col int)
+	// String returns all rows, without trailing blanks, nor trailing empty rows.
+	String() string
+}
+
+// ScreenCheck verifies a TerminalScreen - see Screen.
+type ScreenCheck func(screen TerminalScreen, info string, t *testing.T)
+
+// Screen can be used as a parameter for expected.Output to replay the output (typically of a
+// command run WithPseudoTTY) into a virtual terminal of the given size, interpreting cursor
+// movements, erasing, scrolling, etc, then run the provided checks against the rendered screen.
+// This allows testing progress bars, interactive menus, and other full-screen programs.
+// Note that tigron puts the pty in raw mode, so, line feeds are treated as new lines.
+func Screen(rows, cols int, checks ...ScreenCheck) test.Comparator {
+	//nolint:thelper
+	return func(stdout, info string, t *testing.T) {
+		t.Helper()
+
+		screen := vt.New(rows, cols)
+		screen.NewLineMode = true
+		_, _ = screen.Write([]byte(stdout))
+
+		info = "\nRendered screen:\n" + screen.GoString() + info
+
+		for _, check := range checks {
+			check(screen, info, t)
+		}
+	}
+}
+
+// ScreenRow ensures the text of a row (without trailing blanks) is exactly the provided string.
+func ScreenRow(row int, compare string) ScreenCheck {
+	//nolint:thelper
+	return func(screen TerminalScreen, info string, t *testing.T) {
+		t.Helper()
+
+		actual := screen.Row(row)
+		assertive.Check(t, actual == compare,
+			fmt.Sprintf("Screen row %d is not: %q (actual: %q)", row, compare, actual)+info)
+	}
+}
+
+// ScreenContains ensures the provided string is found on one of the rows.
+func ScreenContains(compare string) ScreenCheck {
+	//nolint:thelper
+	return func(screen TerminalScreen, info string, t *testing.T) {
+		t.Helper()
+
+		found := slices.ContainsFunc(strings.Split(screen.String(), "\n"), func(line string) bool {
+			return strings.Contains(line, compare)
+		})
+
+		assertive.Check(t, found, fmt.Sprintf("Screen does not contain: %q", compare)+info)
+	}
+}
+
+// ScreenCell ensures the character at a position is the provided one.
+func ScreenCell(row, col int, compare rune) ScreenCheck {
+	//nolint:thelper
+	return func(screen TerminalScreen, info string, t *testing.T) {
+		t.Helper()
+
+		actual := screen.Cell(row, col)
+		assertive.Check(t, actual == compare,
+			fmt.Sprintf("Screen cell %d, %d is not: %q (actual: %q)", row, col, compare, actual)+info)
+	}
+}
+
+// ScreenCursor ensures the cursor is at the provided position.
+func ScreenCursor(row, col int) ScreenCheck {
+	//nolint:thelper
+	return func(screen TerminalScreen, info string, t *testing.T) {
+		t.Helper()
+
+		actualRow, actualCol := screen.Cursor()
+		assertive.Check(t, actualRow == row && actualCol == col,
+			fmt.Sprintf("Screen cursor is not at: %d, %d (actual: %d, %d)", row, col, actualRow, actualCol)+
+				info)
+	}
+}
+
+// ScreenSnapshot ensures the whole screen is exactly the provided string: rows separated by new
+// lines, without trailing blanks, nor trailing empty rows.
+func ScreenSnapshot(compare string) ScreenCheck {
+	//nolint:thelper
+	return func(screen TerminalScreen, info string, t *testing.T) {
+		t.Helper()
+
+		assertive.Check(t, screen.String() == compare,
+			fmt.Sprintf("Screen is not:\n%s", compare)+info)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+package expect_test
+
+import (
+	"testing"
+
+	"go.farcloser.world/tigron/expect"
+)
+
+func TestExpectScreen(t *testing.T) {
+	t.Parallel()
+
+	// A progress bar redrawn in place, then a menu drawn with absolute positioning
+	output := "Downloading\n[##   ] 40%\r[#####] 100%\n" +
+		"\x1b[5;1H\x1b[1m> first\x1b[0m\x1b[6;3Hsecond\x1b[5;1H"
+
+	expect.Screen(6, 20,
+		expect.ScreenRow(0, "Downloading"),
+		expect.ScreenRow(1, "[#####] 100%"),
+		expect.ScreenContains("100%"),
+		expect.ScreenCell(4, 0, '>'),
+		expect.ScreenCursor(4, 0),
+		expect.ScreenSnapshot("Downloading\n[#####] 100%\n\n\n> first\n  second"),
+	)(output, "info", t)
+}
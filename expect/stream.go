@@ -0,0 +1,117 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+
+	"go.farcloser.world/tigron/internal/assertive"
+	"go.farcloser.world/tigron/test"
+)
+
+const streamBufferSize = 32 * 1024
+
+// AllStreams can be used as a parameter for expected.OutputStream to group a set of stream
+// comparators. The output is read only once, and passed along to all comparators concurrently.
+func AllStreams(comparators ...test.StreamComparator) test.StreamComparator {
+	//nolint:thelper
+	return func(stdout io.Reader, info string, t *testing.T) {
+		t.Helper()
+
+		writers := make([]io.Writer, 0, len(comparators))
+		closers := make([]*io.PipeWriter, 0, len(comparators))
+		group := &sync.WaitGroup{}
+
+		for _, comparator := range comparators {
+			reader, writer := io.Pipe()
+			writers = append(writers, writer)
+			closers = append(closers, writer)
+
+			group.Add(1)
+
+			go func() {
+				defer group.Done()
+				// Comparators may stop reading early: drain so that others are not blocked
+				defer func() {
+					_, _ = io.Copy(io.Discard, reader)
+				}()
+
+				comparator(reader, info, t)
+			}()
+		}
+
+		_, err := io.Copy(io.MultiWriter(writers...), stdout)
+
+		for _, closer := range closers {
+			_ = closer.CloseWithError(err)
+		}
+
+		group.Wait()
+	}
+}
+
+// StreamContains can be used as a parameter for expected.OutputStream and ensures a comparison
+// string is found contained in the output.
+func StreamContains(compare string) test.StreamComparator {
+	//nolint:thelper
+	return func(stdout io.Reader, info string, t *testing.T) {
+		t.Helper()
+		assertive.Check(t, streamContains(stdout, []byte(compare)),
+			fmt.Sprintf("Output does not contain: %q", compare)+info)
+	}
+}
+
+// StreamDoesNotContain can be used as a parameter for expected.OutputStream to ensure a comparison
+// string is NOT found in the output.
+func StreamDoesNotContain(compare string) test.StreamComparator {
+	//nolint:thelper
+	return func(stdout io.Reader, info string, t *testing.T) {
+		t.Helper()
+		assertive.Check(t, !streamContains(stdout, []byte(compare)),
+			fmt.Sprintf("Output should not contain: %q", compare)+info)
+	}
+}
+
+// streamContains reads through the reader, only keeping in memory what is necessary to find a
+// match overlapping two reads.
+func streamContains(reader io.Reader, compare []byte) bool {
+	keep := len(compare) - 1
+	window := make([]byte, 0, streamBufferSize+keep)
+	buf := make([]byte, streamBufferSize)
+
+	for {
+		read, err := reader.Read(buf)
+		if read > 0 {
+			window = append(window, buf[:read]...)
+			if bytes.Contains(window, compare) {
+				return true
+			}
+
+			if len(window) > keep {
+				window = append(window[:0], window[len(window)-keep:]...)
+			}
+		}
+
+		if err != nil {
+			return len(compare) == 0
+		}
+	}
+}
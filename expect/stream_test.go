@@ -0,0 +1,43 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+package expect_test
+
+import (
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"go.farcloser.world/tigron/expect"
+)
+
+func TestExpectStream(t *testing.T) {
+	t.Parallel()
+
+	large := strings.Repeat("a", 100000) + "needle" + strings.Repeat("b", 100000)
+
+	// OneByteReader ensures matches spanning several reads are found
+	expect.StreamContains("needle")(iotest.OneByteReader(strings.NewReader(large)), "info", t)
+	expect.StreamContains("a")(strings.NewReader(large), "info", t)
+	expect.StreamDoesNotContain("haystack")(strings.NewReader(large), "info", t)
+
+	expect.AllStreams(
+		expect.StreamContains("needle"),
+		expect.StreamContains("leb"),
+		expect.StreamDoesNotContain("ba"),
+	)(strings.NewReader(large), "info", t)
+}
@@ -0,0 +1,315 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package expect
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.farcloser.world/tigron/internal/assertive"
+	"go.farcloser.world/tigron/test"
+)
+
+// tabWidth is the width of tab stops, for output aligned with tabs.
+const tabWidth = 8
+
+var errEmptyTable = errors.New("output has no table header")
+
+// ParsedTable is columnar output (ps style), split into rows keyed by the header column names.
+type ParsedTable struct {
+	Columns []string
+	Rows    []map[string]string
+}
+
+// ParseTable splits output made of a header line followed by rows into a ParsedTable. Empty lines
+// are ignored.
+// Tab-separated output is split on every tab (so that consecutive tabs delimit an empty value),
+// unless the header has consecutive tabs, in which case it is taken as aligned with tabs (as done by
+// text/tabwriter with a tab padding), and parsed as if tabs were expanded to spaces.
+// Otherwise, columns are aligned with spaces: they start where header names do, names being
+// separated by at least two spaces, or by a single one if rows have a value there (so that
+// `CONTAINER ID` is one column, but `PID TTY` are two). The last column extends to the end of the
+// line.
+// Columns are counted in characters (runes), as text/tabwriter does.
+func ParseTable(output string) (*ParsedTable, error) {
+	lines := []string{}
+
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimRight(line, " \r"); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil, errEmptyTable
+	}
+
+	switch {
+	case strings.Contains(strings.TrimRight(lines[0], "\t"), "\t\t"):
+		for index, line := range lines {
+			lines[index] = strings.TrimRight(expandTabs(line), " ")
+		}
+	case slices.ContainsFunc(lines, func(line string) bool { return strings.Contains(line, "\t") }):
+		return tableFromFields(lines, func(line string) []string {
+			return strings.Split(strings.TrimRight(line, "\t"), "\t")
+		}), nil
+	}
+
+	runes := make([][]rune, len(lines))
+	for index, line := range lines {
+		runes[index] = []rune(line)
+	}
+
+	boundaries := tableBoundaries(runes)
+
+	return tableFromFields(lines, func(line string) []string {
+		return tableCut([]rune(line), boundaries)
+	}), nil
+}
+
+// Table can be used as a parameter for expected.Output to parse the output as a table (see
+// ParseTable), then run the provided checks against it.
+func Table(checks ...TableCheck) test.Comparator {
+	//nolint:thelper
+	return func(stdout, info string, t *testing.T) {
+		t.Helper()
+
+		table, err := ParseTable(stdout)
+		if !assertive.Check(t, err == nil, fmt.Sprintf("Output is not a table: %v", err)+info) {
+			return
+		}
+
+		info = fmt.Sprintf("\nParsed table columns: %q", table.Columns) + info
+
+		for _, check := range checks {
+			check(table, info, t)
+		}
+	}
+}
+
+// TableCheck verifies a ParsedTable - see Table.
+type TableCheck func(table *ParsedTable, info string, t *testing.T)
+
+// TableColumns ensures the table header is exactly the provided columns.
+func TableColumns(columns ...string) TableCheck {
+	//nolint:thelper
+	return func(table *ParsedTable, info string, t *testing.T) {
+		t.Helper()
+
+		assertive.Check(t, slices.Equal(table.Columns, columns),
+			fmt.Sprintf("Table columns are not: %q (actual: %q)", columns, table.Columns)+info)
+	}
+}
+
+// TableRowCount ensures the table has count rows (not counting the header).
+func TableRowCount(count int) TableCheck {
+	//nolint:thelper
+	return func(table *ParsedTable, info string, t *testing.T) {
+		t.Helper()
+
+		assertive.Check(t, len(table.Rows) == count,
+			fmt.Sprintf("Table does not have %d rows (actual: %d)", count, len(table.Rows))+info)
+	}
+}
+
+// TableHasRow ensures there is a row where column is value.
+func TableHasRow(column, value string) TableCheck {
+	//nolint:thelper
+	return func(table *ParsedTable, info string, t *testing.T) {
+		t.Helper()
+
+		if !checkColumn(t, table, column, info) {
+			return
+		}
+
+		assertive.Check(t, table.Row(column, value) != nil,
+			fmt.Sprintf("Table has no row where %s is %q", column, value)+info)
+	}
+}
+
+// TableDoesNotHaveRow ensures there is no row where column is value.
+func TableDoesNotHaveRow(column, value string) TableCheck {
+	//nolint:thelper
+	return func(table *ParsedTable, info string, t *testing.T) {
+		t.Helper()
+
+		if !checkColumn(t, table, column, info) {
+			return
+		}
+
+		assertive.Check(t, table.Row(column, value) == nil,
+			fmt.Sprintf("Table should have no row where %s is %q", column, value)+info)
+	}
+}
+
+// TableRowMatches ensures there is a row where keyColumn is keyValue, and that in this row, column
+// matches the regular expression. For example, the row where NAME is "web" has a STATUS matching
+// "^Up".
+func TableRowMatches(keyColumn, keyValue, column string, reg *regexp.Regexp) TableCheck {
+	//nolint:thelper
+	return func(table *ParsedTable, info string, t *testing.T) {
+		t.Helper()
+
+		if !checkColumn(t, table, keyColumn, info) || !checkColumn(t, table, column, info) {
+			return
+		}
+
+		row := table.Row(keyColumn, keyValue)
+		if !assertive.Check(t, row != nil, fmt.Sprintf("Table has no row where %s is %q", keyColumn, keyValue)+info) {
+			return
+		}
+
+		assertive.Check(t, reg.MatchString(row[column]),
+			fmt.Sprintf("In the row where %s is %q, %s does not match: %q (actual: %q)",
+				keyColumn, keyValue, column, reg.String(), row[column])+info)
+	}
+}
+
+// Row returns the first row where column is value, or nil.
+func (table *ParsedTable) Row(column, value string) map[string]string {
+	for _, row := range table.Rows {
+		if row[column] == value {
+			return row
+		}
+	}
+
+	return nil
+}
+
+//nolint:thelper
+func checkColumn(t *testing.T, table *ParsedTable, column, info string) bool {
+	t.Helper()
+
+	return assertive.Check(t, slices.Contains(table.Columns, column),
+		fmt.Sprintf("Table has no column %q (columns: %q)", column, table.Columns)+info)
+}
+
+func tableFromFields(lines []string, split func(line string) []string) *ParsedTable {
+	table := &ParsedTable{Rows: []map[string]string{}}
+
+	for _, field := range split(lines[0]) {
+		table.Columns = append(table.Columns, strings.TrimSpace(field))
+	}
+
+	for _, line := range lines[1:] {
+		row := map[string]string{}
+
+		for index, field := range split(line) {
+			if index < len(table.Columns) {
+				row[table.Columns[index]] = strings.TrimSpace(field)
+			}
+		}
+
+		table.Rows = append(table.Rows, row)
+	}
+
+	return table
+}
+
+// expandTabs replaces tabs with spaces, up to the next tab stop.
+func expandTabs(line string) string {
+	var expanded strings.Builder
+
+	column := 0
+
+	for _, char := range line {
+		if char != '\t' {
+			expanded.WriteRune(char)
+			column++
+
+			continue
+		}
+
+		padding := tabWidth - column%tabWidth
+		expanded.WriteString(strings.Repeat(" ", padding))
+		column += padding
+	}
+
+	return expanded.String()
+}
+
+// tableBoundaries returns the offsets (in runes) where columns start, as found in the header.
+func tableBoundaries(lines [][]rune) []int {
+	header := lines[0]
+	boundaries := []int{0}
+
+	// The first column includes any indentation (right-aligned values)
+	first := 0
+	for first < len(header) && header[first] == ' ' {
+		first++
+	}
+
+	for offset := first + 1; offset < len(header); offset++ {
+		if header[offset] == ' ' || header[offset-1] != ' ' {
+			continue
+		}
+
+		// Two spaces or more in the header always separate columns
+		wide := offset >= 2 && header[offset-2] == ' '
+
+		// A single space does if rows have a value starting there
+		occupied := false
+		separated := true
+
+		for _, line := range lines[1:] {
+			occupied = occupied || (offset < len(line) && line[offset] != ' ')
+			separated = separated && (offset >= len(line) || line[offset-1] == ' ')
+		}
+
+		if wide || (occupied && separated) {
+			boundaries = append(boundaries, offset)
+		}
+	}
+
+	return boundaries
+}
+
+// tableCut splits a line at boundaries. A word across a boundary belongs to the next column
+// (right-aligned value), unless it is the only one in its column (overflowing value).
+func tableCut(line []rune, boundaries []int) []string {
+	fields := []string{}
+	start := 0
+
+	for _, boundary := range boundaries[1:] {
+		end := min(max(boundary, start), len(line))
+
+		wordStart := end
+		for wordStart > start && line[wordStart-1] != ' ' {
+			wordStart--
+		}
+
+		switch {
+		case wordStart == end:
+			// Not inside a word
+		case strings.TrimSpace(string(line[start:wordStart])) != "":
+			end = wordStart
+		default:
+			for end < len(line) && line[end] != ' ' {
+				end++
+			}
+		}
+
+		fields = append(fields, string(line[start:end]))
+		start = end
+	}
+
+	return append(fields, string(line[start:]))
+}
@@ -0,0 +1,126 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+package expect_test
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"testing"
+	"text/tabwriter"
+
+	"go.farcloser.world/tigron/expect"
+	"go.farcloser.world/tigron/internal/assertive"
+)
+
+func TestExpectTable(t *testing.T) {
+	t.Parallel()
+
+	output := `CONTAINER ID   IMAGE          STATUS          NAMES
+0123456789ab   nginx:latest   Up 2 hours      web
+ba9876543210   redis          Exited (0) 1s   cache
+
+`
+
+	expect.Table(
+		expect.TableColumns("CONTAINER ID", "IMAGE", "STATUS", "NAMES"),
+		expect.TableRowCount(2),
+		expect.TableHasRow("NAMES", "cache"),
+		expect.TableDoesNotHaveRow("NAMES", "db"),
+		expect.TableRowMatches("NAMES", "web", "STATUS", regexp.MustCompile("^Up ")),
+		expect.TableRowMatches("IMAGE", "redis", "CONTAINER ID", regexp.MustCompile("^ba98")),
+	)(output, "info", t)
+}
+
+func TestParseTable(t *testing.T) {
+	t.Parallel()
+
+	// Right-aligned numbers, single spaces between some columns, and a last column with spaces
+	table, err := expect.ParseTable(`    PID TTY          TIME CMD
+      1 ?        00:00:02 /sbin/init splash
+  12345 pts/0    00:00:00 bash
+`)
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, len(table.Columns), 4)
+	assertive.IsEqual(t, table.Row("PID", "1")["CMD"], "/sbin/init splash")
+	assertive.IsEqual(t, table.Row("PID", "12345")["TTY"], "pts/0")
+
+	// Tab-separated, with an empty value
+	table, err = expect.ParseTable("NAME\tSIZE\tCREATED\nalpine\t7MB\t2 days ago\nbusybox\t\tnow\n")
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, table.Row("NAME", "busybox")["SIZE"], "")
+	assertive.IsEqual(t, table.Row("NAME", "busybox")["CREATED"], "now")
+	assertive.IsEqual(t, table.Row("NAME", "alpine")["CREATED"], "2 days ago")
+
+	// Aligned with tabs
+	var aligned bytes.Buffer
+
+	writer := tabwriter.NewWriter(&aligned, 0, 8, 1, '\t', 0)
+	_, _ = fmt.Fprint(writer, "NAME\tPORTS\tSTATUS\nsomeverylongname\t80/tcp\tUp\nweb\t\tExited\n")
+	_ = writer.Flush()
+
+	table, err = expect.ParseTable(aligned.String())
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, table.Row("NAME", "web")["PORTS"], "")
+	assertive.IsEqual(t, table.Row("NAME", "web")["STATUS"], "Exited")
+	assertive.IsEqual(t, table.Row("NAME", "someverylongname")["PORTS"], "80/tcp")
+
+	// Values overflowing their column
+	table, err = expect.ParseTable("NAME  SIZE\nverylongname 1MB\n")
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, table.Row("NAME", "verylongname")["SIZE"], "1MB")
+
+	_, err = expect.ParseTable("\n\n")
+
+	assertive.True(t, err != nil)
+}
+
+func TestParseTableEmptyValues(t *testing.T) {
+	t.Parallel()
+
+	table, err := expect.ParseTable("NAME    PORTS   STATUS\nweb             Up\ndb      5432    Exited\n")
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, table.Row("NAME", "web")["PORTS"], "")
+	assertive.IsEqual(t, table.Row("NAME", "web")["STATUS"], "Up")
+	assertive.IsEqual(t, table.Row("NAME", "db")["PORTS"], "5432")
+}
+
+func TestParseTableMultibyte(t *testing.T) {
+	t.Parallel()
+
+	// Aligned with spaces, then with tabs: text/tabwriter counts characters, not bytes
+	for _, padChar := range []byte{' ', '\t'} {
+		var aligned bytes.Buffer
+
+		writer := tabwriter.NewWriter(&aligned, 0, 8, 3, padChar, 0)
+		_, _ = fmt.Fprint(writer, "NAME\tSTATUS\tPORTS\n日本語日本語\tExited\t-\nweb\tUp\t80/tcp\n")
+		_ = writer.Flush()
+
+		table, err := expect.ParseTable(aligned.String())
+
+		assertive.ErrorIsNil(t, err)
+		assertive.IsEqual(t, table.Row("NAME", "日本語日本語")["STATUS"], "Exited")
+		assertive.IsEqual(t, table.Row("NAME", "日本語日本語")["PORTS"], "-")
+		assertive.IsEqual(t, table.Row("NAME", "web")["PORTS"], "80/tcp")
+	}
+}
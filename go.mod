@@ -5,7 +5,6 @@ go 1.23.0
 require (
 	go.uber.org/goleak v1.3.0
 	golang.org/x/sync v0.12.0
+	golang.org/x/sys v0.31.0
 	golang.org/x/term v0.30.0
 )
-
-require golang.org/x/sys v0.31.0 // indirect
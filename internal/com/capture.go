@@ -0,0 +1,99 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package com
+
+import (
+	"bytes"
+	"os"
+
+	"go.farcloser.world/tigron/internal/logger"
+)
+
+// capture holds the output of a stream in memory, up to limit bytes.
+// Past that, the full content of the stream is spilled into a file inside dir, and only the head
+// of it is kept in memory.
+// Write never fails, as that would interrupt the copy from the command, possibly blocking it.
+type capture struct {
+	stream Stream
+	limit  int64
+	dir    string
+	log    logger.Logger
+
+	buffer    bytes.Buffer
+	file      *os.File
+	truncated bool
+}
+
+func (cp *capture) Write(data []byte) (int, error) {
+	if cp.limit <= 0 {
+		cp.buffer.Write(data)
+
+		return len(data), nil
+	}
+
+	if !cp.truncated {
+		room := int(cp.limit) - cp.buffer.Len()
+		if len(data) <= room {
+			cp.buffer.Write(data)
+
+			return len(data), nil
+		}
+
+		cp.truncated = true
+		cp.spill()
+		cp.buffer.Write(data[:room])
+	}
+
+	if cp.file != nil {
+		if _, err := cp.file.Write(data); err != nil {
+			cp.log.Log(" x failed writing spill file", err)
+		}
+	}
+
+	return len(data), nil
+}
+
+// spill creates the spill file and copies in there what has been buffered so far.
+func (cp *capture) spill() {
+	file, err := os.CreateTemp(cp.dir, cp.stream.String()+"-*")
+	if err != nil {
+		cp.log.Log(" x failed creating spill file, output will be truncated", err)
+
+		return
+	}
+
+	cp.log.Log("<- output too large, spilling to", file.Name())
+
+	if _, err = file.Write(cp.buffer.Bytes()); err != nil {
+		cp.log.Log(" x failed writing spill file", err)
+	}
+
+	cp.file = file
+}
+
+// close closes the spill file if any, and returns its path.
+func (cp *capture) close() string {
+	if cp.file == nil {
+		return ""
+	}
+
+	if err := cp.file.Close(); err != nil {
+		cp.log.Log(" x failed closing spill file", err)
+	}
+
+	return cp.file.Name()
+}
@@ -22,7 +22,7 @@ import (
 	"io"
 	"os"
 	"os/exec"
-	"strings"
+	"regexp"
 	"sync"
 	"syscall"
 	"time"
@@ -48,6 +48,22 @@ var (
 	ErrExecutionFailed = errors.New("command returned a non-zero exit code")
 	// ErrFailedSendingSignal may happen if sending a signal to an already terminated process.
 	ErrFailedSendingSignal = errors.New("failed sending signal")
+	// ErrNoPTY is returned by Resize() if the command has no pty.
+	ErrNoPTY = errors.New("command does not have a pty")
+	// ErrStdinNotOpen is returned by Write() and CloseStdin() if the command was not asked to keep
+	// stdin open (WithOpenStdin).
+	ErrStdinNotOpen = errors.New("stdin is not open (see WithOpenStdin)")
+	// ErrSandboxNotSupported is returned by Run() when asked for a Sandbox on a platform other than
+	// linux.
+	ErrSandboxNotSupported = errors.New("sandboxing is only supported on linux")
+	// ErrSandboxUnavailable is returned by Run() when a Sandbox cannot be set up (eg: the ip command
+	// is missing).
+	ErrSandboxUnavailable = errors.New("sandbox cannot be set up")
+	// ErrLimitsNotSupported is returned by Run() when asked for Limits on windows.
+	ErrLimitsNotSupported = errors.New("resource limits are not supported on windows")
+	// ErrLimitsAboveHard is returned by Run() when asked for Limits above the current hard limits,
+	// that the command could not raise.
+	ErrLimitsAboveHard = errors.New("resource limit above the current hard limit")
 
 	// ErrExecAlreadyStarted is a system error normally indicating a bogus double call to Run().
 	ErrExecAlreadyStarted = errors.New("command has already been started (double `Run`)")
@@ -56,8 +72,9 @@ var (
 	ErrExecNotStarted = errors.New("command has not been started (call `Run` first)")
 	// ErrExecAlreadyFinished is a system error indicating a double call to Wait().
 	ErrExecAlreadyFinished = errors.New("command is already finished")
-
-	errExecutionCancelled = errors.New("command execution cancelled")
+	// ErrCancelled is returned by Wait() if the context passed to Run() got cancelled before the
+	// command completed.
+	ErrCancelled = errors.New("command execution cancelled")
 )
 
 type contextKey string
@@ -67,11 +84,66 @@ const LoggerKey = contextKey("logger")
 
 // Result carries the resulting output of a command once it has finished.
 type Result struct {
-	Environ  []string
-	Stdout   string
-	Stderr   string
-	ExitCode int
-	Signal   os.Signal
+	Environ    []string
+	Stdout     string
+	Stderr     string
+	Transcript Transcript
+	ExitCode   int
+	Signal     os.Signal
+	// Truncated is true if the output exceeded Command.MaxOutputSize, in which case Stdout and / or
+	// Stderr only hold the beginning of it.
+	Truncated bool
+	// StdoutSpill and StderrSpill hold the path to a file containing the full output, if it got
+	// truncated.
+	StdoutSpill string
+	StderrSpill string
+	// CancelSignal is the last signal sent to the process group when the command got cancelled or
+	// timed out (nil otherwise). With TimeoutEscalation, this tells which stage ended the command.
+	CancelSignal os.Signal
+	// Duration is the wall-clock time between start and exit of the command.
+	Duration time.Duration
+	// UserTime and SystemTime are the CPU time consumed by the command (and its waited-for
+	// children).
+	UserTime   time.Duration
+	SystemTime time.Duration
+	// MaxRSS is the peak resident set size of the command, in bytes (zero where unsupported).
+	MaxRSS int64
+	// Orphans lists the processes of the command process group or session that were still alive
+	// after it exited (linux only). If Command.KillOrphans is set, they have been killed.
+	Orphans []*Orphan
+}
+
+// Orphan is a process left behind by a command.
+type Orphan struct {
+	PID     int
+	Command string
+}
+
+// Escalation is a step of the termination sequence of a command that timed out or got cancelled.
+// Signal is sent to the process group, then the process is given Grace to exit before moving on to
+// the next step.
+type Escalation struct {
+	Signal os.Signal
+	Grace  time.Duration
+}
+
+// Limits are resource limits (rlimits) applied to a command when it starts. Zero leaves a limit
+// unchanged. Exceeding CPUTime gets the command terminated by SIGXCPU, while exceeding the other
+// limits makes the corresponding system calls fail (allocating memory, opening files, forking).
+// Note that Processes counts all the processes of the user, and is not enforced for root.
+// Limits are hard limits: neither the command nor its children can raise them back, and they
+// cannot be raised above the current hard limits of the test either.
+type Limits struct {
+	// OpenFiles is the maximum number of open file descriptors.
+	OpenFiles int64
+	// AddressSpace is the maximum size of the virtual memory of the process, in bytes.
+	AddressSpace int64
+	// CPUTime is the maximum CPU time (rounded up to the second).
+	CPUTime time.Duration
+	// CoreSize is the maximum size of core dumps, in bytes.
+	CoreSize int64
+	// Processes is the maximum number of processes of the user.
+	Processes int64
 }
 
 type execution struct {
@@ -80,8 +152,19 @@ type execution struct {
 	cancel  context.CancelFunc
 	command *exec.Cmd
 	pipes   *stdPipes
+	dialog  *dialog
+	record  *transcriber
 	log     logger.Logger
 	err     error
+	// signalGroup sends a signal to the process group (nil on windows)
+	signalGroup func(sig os.Signal)
+
+	// exited is closed once the process has been reaped
+	exited       chan struct{}
+	start        time.Time
+	end          time.Time
+	cancelSignal os.Signal
+	signalMutex  sync.Mutex
 }
 
 // Command is a thin wrapper on-top of golang exec.Command.
@@ -95,14 +178,62 @@ type Command struct {
 
 	WorkingDir string
 	Env        map[string]string
-	// FIXME: EnvBlackList might change for a better mechanism (regexp and/or whitelist + blacklist)
+	// EnvBlackList lists host variables that are not passed along to the command ("*" excludes
+	// them all).
 	EnvBlackList []string
-
-	writers []func() io.Reader
-
-	ptyStdout bool
-	ptyStderr bool
-	ptyStdin  bool
+	// EnvWhiteList, if not empty, lists the only host variables passed along to the command (still
+	// subject to EnvBlackList).
+	EnvWhiteList []string
+	// EnvBlackListPatterns and EnvWhiteListPatterns complement the above with regular expressions
+	// matched against variable names.
+	EnvBlackListPatterns []*regexp.Regexp
+	EnvWhiteListPatterns []*regexp.Regexp
+	// EnvUnset lists variables that are removed from the environment of the command, even if
+	// defined in Env.
+	EnvUnset []string
+
+	// MaxOutputSize is the maximum number of bytes of stdout (and of stderr) held in memory.
+	// Past that, the full output is written to a file inside SpillDir (default to the system
+	// temporary directory). Zero means no limit.
+	MaxOutputSize int64
+	SpillDir      string
+
+	// TimeoutEscalation is the sequence of signals sent to the process group on timeout or
+	// cancellation, before it gets killed. If empty, the process group is killed right away.
+	// This is not supported on windows, where only the process is killed.
+	TimeoutEscalation []*Escalation
+
+	// KillOrphans requests that processes left behind by the command (see Result.Orphans) get
+	// killed.
+	KillOrphans bool
+
+	// Sandbox runs the command in new user (mapping the current user to root), mount, pid, network
+	// and uts namespaces (linux only, and provided the kernel allows unprivileged user namespaces).
+	// The command then only sees the loopback interface, a private /tmp, and its own processes.
+	// The working directory and SandboxPaths remain reachable even if they are inside /tmp.
+	// As the command does not run as the init process of the sandbox, its exit code is reported
+	// as 128 + signal number if it gets killed by a signal, and Signal addresses the process group.
+	Sandbox      bool
+	SandboxPaths []string
+
+	// Limits are the resource limits applied to the command (not supported on windows).
+	Limits *Limits
+
+	writers         []func() io.Reader
+	stdoutObservers []func() io.Writer
+	stderrObservers []func() io.Writer
+	dialog          []*DialogStep
+
+	ptyStdout         bool
+	ptyStderr         bool
+	ptyStdin          bool
+	ptySeparateStderr bool
+	ptyRows           uint16
+	ptyCols           uint16
+	openStdin         bool
+
+	stdin  *os.File
+	stdout *os.File
 
 	exec   *execution
 	mutex  sync.Mutex
@@ -122,12 +253,34 @@ func (gc *Command) Clone() *Command {
 		WorkingDir:   gc.WorkingDir,
 		Env:          map[string]string{},
 		EnvBlackList: append([]string(nil), gc.EnvBlackList...),
-
-		writers: append([]func() io.Reader(nil), gc.writers...),
-
-		ptyStdout: gc.ptyStdout,
-		ptyStderr: gc.ptyStderr,
-		ptyStdin:  gc.ptyStdin,
+		EnvWhiteList: append([]string(nil), gc.EnvWhiteList...),
+		EnvUnset:     append([]string(nil), gc.EnvUnset...),
+
+		EnvBlackListPatterns: append([]*regexp.Regexp(nil), gc.EnvBlackListPatterns...),
+		EnvWhiteListPatterns: append([]*regexp.Regexp(nil), gc.EnvWhiteListPatterns...),
+
+		MaxOutputSize: gc.MaxOutputSize,
+		SpillDir:      gc.SpillDir,
+
+		TimeoutEscalation: append([]*Escalation(nil), gc.TimeoutEscalation...),
+		KillOrphans:       gc.KillOrphans,
+
+		Sandbox:      gc.Sandbox,
+		SandboxPaths: append([]string(nil), gc.SandboxPaths...),
+		Limits:       gc.Limits,
+
+		writers:         append([]func() io.Reader(nil), gc.writers...),
+		stdoutObservers: append([]func() io.Writer(nil), gc.stdoutObservers...),
+		stderrObservers: append([]func() io.Writer(nil), gc.stderrObservers...),
+		dialog:          append([]*DialogStep(nil), gc.dialog...),
+
+		ptyStdout:         gc.ptyStdout,
+		ptyStderr:         gc.ptyStderr,
+		ptyStdin:          gc.ptyStdin,
+		ptySeparateStderr: gc.ptySeparateStderr,
+		ptyRows:           gc.ptyRows,
+		ptyCols:           gc.ptyCols,
+		openStdin:         gc.openStdin,
 	}
 
 	for k, v := range gc.Env {
@@ -146,6 +299,46 @@ func (gc *Command) WithPTY(stdin, stdout, stderr bool) {
 	gc.ptyStdin = stdin
 }
 
+// WithPTYSize sets the window size (rows and columns) of the pty, if any (default to whatever the
+// system gives).
+// This command has no effect if Run has already been called.
+func (gc *Command) WithPTYSize(rows, cols uint16) {
+	gc.ptyRows = rows
+	gc.ptyCols = cols
+}
+
+// WithSeparateStderrPTY requests that stderr, if tied to a pty, gets its own pty instead of sharing
+// the one of stdin and stdout. This allows capturing stderr separately, while the command still
+// sees a terminal on both streams.
+// This command has no effect if Run has already been called.
+func (gc *Command) WithSeparateStderrPTY() {
+	gc.ptySeparateStderr = true
+}
+
+// WithOpenStdin keeps stdin open once feeders and dialog steps are done (instead of closing it), until
+// the command exits, or a dialog step closes it. Commands reading stdin until EOF will then only
+// return on timeout.
+// This command has no effect if Run has already been called.
+func (gc *Command) WithOpenStdin() {
+	gc.openStdin = true
+}
+
+// WithStdin connects the command stdin directly to the provided file (typically the reading end of
+// an os.Pipe), instead of feeders or a pty. The caller remains responsible for closing it once the
+// command has started. The file is not retained by Clone.
+// This command has no effect if Run has already been called.
+func (gc *Command) WithStdin(file *os.File) {
+	gc.stdin = file
+}
+
+// WithStdout connects the command stdout directly to the provided file (typically the writing end
+// of an os.Pipe), in which case Result.Stdout stays empty. The caller remains responsible for
+// closing it once the command has started. The file is not retained by Clone.
+// This command has no effect if Run has already been called.
+func (gc *Command) WithStdout(file *os.File) {
+	gc.stdout = file
+}
+
 // WithFeeder ensures that the provider function will be executed and its output fed to the command
 // stdin. WithFeeder, like Feed, can be used multiple times, and writes will be performed
 // sequentially, in order.
@@ -164,6 +357,21 @@ func (gc *Command) Feed(reader io.Reader) {
 	})
 }
 
+// WithObserver registers providers for writers that will receive a copy of the stdout or stderr of
+// the command, as it is being produced. Providers are called every time the command is Run.
+// Writers are called from the go routine reading the stream, and should not block. If they
+// implement io.Closer, they will be closed once the stream is done.
+// Note that if both stdout and stderr are tied to the same pty (see WithSeparateStderrPTY), stderr
+// observers will not see anything, as everything will be read from stdout.
+// This command has no effect if Run has already been called.
+func (gc *Command) WithObserver(stream Stream, observers ...func() io.Writer) {
+	if stream == Stderr {
+		gc.stderrObservers = append(gc.stderrObservers, observers...)
+	} else {
+		gc.stdoutObservers = append(gc.stdoutObservers, observers...)
+	}
+}
+
 // Run starts the command in the background.
 // It may error out immediately if the command fails to start (ErrFailedStarting).
 func (gc *Command) Run(parentCtx context.Context) error {
@@ -195,7 +403,7 @@ func (gc *Command) Run(parentCtx context.Context) error {
 	ctx, ctxCancel = context.WithTimeout(parentCtx, timeout)
 
 	// Create a contextual command, set the logger
-	cmd = gc.buildCommand(ctx)
+	cmd, signalGroup := gc.buildCommand(ctx)
 	// Get a debug-logger from the context
 	var (
 		log logger.Logger
@@ -217,15 +425,55 @@ func (gc *Command) Run(parentCtx context.Context) error {
 		cancel:  ctxCancel,
 		command: cmd,
 		log:     conLog,
+		exited:  make(chan struct{}),
+
+		signalGroup: signalGroup,
+	}
+
+	// Always record a transcript of the output
+	gc.exec.record = &transcriber{start: time.Now(), limit: gc.MaxOutputSize}
+
+	writers := gc.writers
+	stdoutObservers := append(
+		append([]func() io.Writer(nil), gc.stdoutObservers...),
+		gc.exec.record.observer(Stdout),
+	)
+	stderrObservers := append(
+		append([]func() io.Writer(nil), gc.stderrObservers...),
+		gc.exec.record.observer(Stderr),
+	)
+
+	// Attach the dialog, if any
+	if len(gc.dialog) > 0 {
+		gc.exec.dialog = newDialog(gc.dialog, ctxCancel, gc.MaxOutputSize)
+		writers = append(append([]func() io.Reader(nil), writers...), gc.exec.dialog.feeders()...)
+		stdoutObservers = append(stdoutObservers, gc.exec.dialog.observer(Stdout))
+		stderrObservers = append(stderrObservers, gc.exec.dialog.observer(Stderr))
 	}
 
 	// Prepare pipes
-	pipes, err = newStdPipes(ctx, emLog, gc.ptyStdout, gc.ptyStderr, gc.ptyStdin, gc.writers)
+	pipes, err = newStdPipes(ctx, emLog, &pipesOptions{
+		ptyStdout:         gc.ptyStdout,
+		ptyStderr:         gc.ptyStderr,
+		ptyStdin:          gc.ptyStdin,
+		ptySeparateStderr: gc.ptySeparateStderr,
+		writers:           writers,
+		openStdin:         gc.openStdin,
+		ptyRows:           gc.ptyRows,
+		ptyCols:           gc.ptyCols,
+		stdoutObservers:   provide(stdoutObservers),
+		stderrObservers:   provide(stderrObservers),
+		outputLimit:       gc.MaxOutputSize,
+		spillDir:          gc.SpillDir,
+	})
 	if err != nil {
 		ctxCancel()
 
 		gc.exec.err = errors.Join(ErrFailedStarting, err)
 
+		// There is no process to wait for
+		close(gc.exec.exited)
+
 		// No wrapping here - we do not even have pipes, and the command has not been started.
 
 		return gc.exec.err
@@ -237,13 +485,27 @@ func (gc *Command) Run(parentCtx context.Context) error {
 	cmd.Stderr = pipes.stderr.writer
 	cmd.Stdin = pipes.stdin.reader
 
+	// Explicit files take precedence
+	if gc.stdin != nil {
+		cmd.Stdin = gc.stdin
+	}
+
+	if gc.stdout != nil {
+		cmd.Stdout = gc.stdout
+	}
+
 	// Start it
+	gc.exec.start = time.Now()
+
 	if err = cmd.Start(); err != nil {
 		// On failure, can the context, wrap whatever we have and return
 		gc.exec.log.Log("start failed", err)
 
 		gc.exec.err = errors.Join(ErrFailedStarting, err)
 
+		// There is no process to wait for
+		close(gc.exec.exited)
+
 		_ = gc.wrap()
 
 		defer ctxCancel()
@@ -251,9 +513,20 @@ func (gc *Command) Run(parentCtx context.Context) error {
 		return gc.exec.err
 	}
 
+	// Reap the process as soon as it exits, so that timeout escalation knows when to stop
+	go func() {
+		_ = cmd.Wait()
+
+		gc.exec.end = time.Now()
+
+		close(gc.exec.exited)
+	}()
+
 	select {
 	case <-ctx.Done():
 		// There is no good reason for this to happen, so, log it
+		<-gc.exec.exited
+
 		err = gc.wrap()
 
 		gc.exec.log.Log("stdout", gc.result.Stdout)
@@ -271,36 +544,93 @@ func (gc *Command) Run(parentCtx context.Context) error {
 
 // Wait should be called after Run(), and will return the outcome of the command execution.
 func (gc *Command) Wait() (*Result, error) {
+	gc.mutex.Lock()
+	running, err := gc.waitable()
+	result := gc.result
+	gc.mutex.Unlock()
+
+	if err != nil {
+		return result, err
+	}
+
+	// Wait for the command, without holding the lock, so that it can be cancelled or signalled
+	<-running.exited
+
 	gc.mutex.Lock()
 	defer gc.mutex.Unlock()
 
-	switch {
-	case gc.exec == nil:
-		return nil, ErrExecNotStarted
-	case gc.exec.err != nil:
-		return gc.result, gc.exec.err
-	case gc.result != nil:
+	// Another call may have waited for it meanwhile
+	if gc.result != nil {
 		return gc.result, ErrExecAlreadyFinished
 	}
 
 	// Cancel the context in any case now
-	defer gc.exec.cancel()
-
-	// Wait for the command
-	_ = gc.exec.command.Wait()
+	defer running.cancel()
 
 	// Capture timeout and cancellation
 	select {
-	case <-gc.exec.context.Done():
+	case <-running.context.Done():
 	default:
 	}
 
 	// Wrap the results and return
-	err := gc.wrap()
+	err = gc.wrap()
 
 	return gc.result, err
 }
 
+// Resize changes the window size of the pty of a running command, and notifies its process group
+// with SIGWINCH (the pty is not its controlling terminal, so the system does not).
+// It should be called after Run() but before Wait().
+func (gc *Command) Resize(rows, cols uint16) error {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	switch {
+	case gc.exec == nil:
+		return ErrExecNotStarted
+	case gc.exec.err != nil:
+		return gc.exec.err
+	case gc.result != nil:
+		return ErrExecAlreadyFinished
+	case len(gc.exec.pipes.ptys) == 0:
+		return ErrNoPTY
+	}
+
+	if err := gc.exec.pipes.resize(rows, cols); err != nil {
+		return err
+	}
+
+	notifyResize(gc.exec.command)
+
+	return nil
+}
+
+// Exited returns a channel that is closed once the command process has exited, which allows
+// watching a command without waiting for it. It returns nil if the command has not been started.
+func (gc *Command) Exited() <-chan struct{} {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	if gc.exec == nil {
+		return nil
+	}
+
+	return gc.exec.exited
+}
+
+// Cancel terminates the command, the same way a timeout would (see TimeoutEscalation). Wait() still
+// needs to be called, and will return ErrCancelled. It has no effect if the command has not been
+// started, or has already been waited for.
+func (gc *Command) Cancel() {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	if gc.exec != nil {
+		gc.exec.cancel()
+	}
+}
+
 // Signal sends a signal to the command. It should be called after Run() but before Wait().
 func (gc *Command) Signal(sig os.Signal) error {
 	gc.mutex.Lock()
@@ -310,6 +640,13 @@ func (gc *Command) Signal(sig os.Signal) error {
 		return ErrExecNotStarted
 	}
 
+	if gc.Sandbox && gc.exec.signalGroup != nil {
+		// The init process of the sandbox does not relay signals - address the group instead
+		gc.exec.signalGroup(sig)
+
+		return nil
+	}
+
 	err := gc.exec.command.Process.Signal(sig)
 	if err != nil {
 		err = errors.Join(ErrFailedSendingSignal, err)
@@ -318,6 +655,70 @@ func (gc *Command) Signal(sig os.Signal) error {
 	return err
 }
 
+// Write writes to the command stdin. It should be called after Run() but before Wait(), and
+// requires WithOpenStdin. Note that writes may interleave with feeders and dialogs, if any.
+func (gc *Command) Write(data []byte) (int, error) {
+	// Do not hold the lock while writing, as this blocks until the command reads
+	gc.mutex.Lock()
+	writer, err := gc.stdinWriter()
+	gc.mutex.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := writer.Write(data)
+	if err != nil {
+		err = errors.Join(ErrFailedWriting, err)
+	}
+
+	return count, err
+}
+
+// CloseStdin ends the command stdin (with a pty, ^D is sent instead). It should be called after
+// Run() but before Wait(), and requires WithOpenStdin.
+func (gc *Command) CloseStdin() error {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+
+	if _, err := gc.stdinWriter(); err != nil {
+		return err
+	}
+
+	gc.exec.pipes.closeStdin(gc.ptyStdin)
+
+	return nil
+}
+
+// waitable returns the execution to wait for, if any.
+func (gc *Command) waitable() (*execution, error) {
+	switch {
+	case gc.exec == nil:
+		return nil, ErrExecNotStarted
+	case gc.exec.err != nil:
+		return nil, gc.exec.err
+	case gc.result != nil:
+		return nil, ErrExecAlreadyFinished
+	}
+
+	return gc.exec, nil
+}
+
+func (gc *Command) stdinWriter() (io.WriteCloser, error) {
+	switch {
+	case gc.exec == nil:
+		return nil, ErrExecNotStarted
+	case gc.exec.err != nil:
+		return nil, gc.exec.err
+	case gc.result != nil:
+		return nil, ErrExecAlreadyFinished
+	case !gc.openStdin || gc.exec.pipes.stdin.writer == nil:
+		return nil, ErrStdinNotOpen
+	}
+
+	return gc.exec.pipes.stdin.writer, nil
+}
+
 func (gc *Command) wrap() error {
 	pipes := gc.exec.pipes
 	cmd := gc.exec.command
@@ -359,17 +760,39 @@ func (gc *Command) wrap() error {
 	case context.DeadlineExceeded:
 		err = ErrTimeout
 	case context.Canceled:
-		err = errExecutionCancelled
+		err = ErrCancelled
 	default:
 	}
 
+	// A failed dialog is the reason the command got cancelled, so, report that instead
+	if gc.exec.dialog != nil {
+		if dialogErr := gc.exec.dialog.failed(); dialogErr != nil {
+			err = dialogErr
+		}
+	}
+
 	// Stuff everything in Result and return err
 	gc.result = &Result{
-		ExitCode: exitCode,
-		Stdout:   pipes.fromStdout,
-		Stderr:   pipes.fromStderr,
-		Environ:  cmd.Environ(),
-		Signal:   signal,
+		ExitCode:   exitCode,
+		Stdout:     pipes.fromStdout,
+		Stderr:     pipes.fromStderr,
+		Transcript: gc.exec.record.transcript(),
+		Environ:    cmd.Environ(),
+		Signal:     signal,
+
+		Truncated:   pipes.truncated[Stdout] || pipes.truncated[Stderr],
+		StdoutSpill: pipes.stdoutSpill,
+		StderrSpill: pipes.stderrSpill,
+
+		CancelSignal: gc.exec.getCancelSignal(),
+	}
+
+	if cmd.ProcessState != nil {
+		gc.result.Duration = gc.exec.end.Sub(gc.exec.start)
+		gc.result.UserTime = cmd.ProcessState.UserTime()
+		gc.result.SystemTime = cmd.ProcessState.SystemTime()
+		gc.result.MaxRSS = maxRSS(cmd.ProcessState)
+		gc.result.Orphans = gc.orphans(cmd.ProcessState.Pid())
 	}
 
 	if gc.exec.err == nil {
@@ -379,7 +802,37 @@ func (gc *Command) wrap() error {
 	return gc.exec.err
 }
 
-func (gc *Command) buildCommand(ctx context.Context) *exec.Cmd {
+// orphans looks for survivors of the command. Since processes killed alongside the command may take
+// a moment to go away, candidates are given a short delay before being reported.
+func (gc *Command) orphans(pid int) []*Orphan {
+	orphans := findOrphans(pid)
+	if len(orphans) > 0 {
+		time.Sleep(delayAfterWait)
+
+		orphans = findOrphans(pid)
+	}
+
+	if len(orphans) > 0 {
+		gc.exec.log.Log("command left processes behind", len(orphans))
+
+		if gc.KillOrphans {
+			killOrphans(orphans)
+		}
+	}
+
+	return orphans
+}
+
+func provide(providers []func() io.Writer) []io.Writer {
+	writers := make([]io.Writer, 0, len(providers))
+	for _, provider := range providers {
+		writers = append(writers, provider())
+	}
+
+	return writers
+}
+
+func (gc *Command) buildCommand(ctx context.Context) (*exec.Cmd, func(sig os.Signal)) {
 	// Build arguments and binary
 	args := gc.Args
 	if gc.PrependArgs != nil {
@@ -400,42 +853,90 @@ func (gc *Command) buildCommand(ctx context.Context) *exec.Cmd {
 	// Add dir
 	cmd.Dir = gc.WorkingDir
 
-	// Set wait delay after waits returns
+	// Set wait delay after waits returns, leaving enough time for the escalation to complete
 	cmd.WaitDelay = delayAfterWait
+	for _, step := range gc.TimeoutEscalation {
+		cmd.WaitDelay += step.Grace
+	}
 
 	// Build env
-	cmd.Env = []string{}
-	// TODO: replace with regexps? and/or whitelist?
-	for _, envValue := range os.Environ() {
-		add := true
+	cmd.Env = gc.environ()
 
-		for _, b := range gc.EnvBlackList {
-			if b == "*" || strings.HasPrefix(envValue, b+"=") {
-				add = false
+	// Attach platform ProcAttr and get optional process group signalling routine
+	signalGroup := addAttr(cmd)
+	if signalGroup != nil {
+		cmd.Cancel = func() error {
+			gc.exec.log.Log("command cancelled")
 
-				break
-			}
-		}
+			gc.terminate(signalGroup)
 
-		if add {
-			cmd.Env = append(cmd.Env, envValue)
+			return nil
 		}
 	}
 
-	// Attach any explicit env we have
-	for k, v := range gc.Env {
-		cmd.Env = append(cmd.Env, k+"="+v)
+	// Sandbox and limits are set up by a shell prelude, before running the binary
+	var prelude []string
+
+	if gc.Sandbox {
+		prelude = append(prelude, sandbox(cmd, gc.SandboxPaths)...)
 	}
 
-	// Attach platform ProcAttr and get optional custom cancellation routine
-	if cancellation := addAttr(cmd); cancellation != nil {
-		cmd.Cancel = func() error {
-			gc.exec.log.Log("command cancelled")
+	if gc.Limits != nil {
+		prelude = append(prelude, gc.Limits.prelude(cmd)...)
+	}
 
-			// Call the platform dependent cancellation routine
-			return cancellation()
-		}
+	if len(prelude) > 0 {
+		withPrelude(cmd, prelude, gc.Sandbox)
+	}
+
+	return cmd, signalGroup
+}
+
+// terminate sends the first signal of the escalation sequence to the process group, then walks the
+// rest of it in the background. It does return right away, as exec.Cmd blocks on Cancel.
+func (gc *Command) terminate(signalGroup func(sig os.Signal)) {
+	steps := append(append([]*Escalation(nil), gc.TimeoutEscalation...), &Escalation{Signal: os.Kill})
+	exe := gc.exec
+
+	send := func(sig os.Signal) {
+		exe.log.Log("sending signal to process group", sig)
+		exe.setCancelSignal(sig)
+		signalGroup(sig)
+	}
+
+	send(steps[0].Signal)
+
+	if len(steps) == 1 {
+		return
 	}
 
-	return cmd
+	go func() {
+		for index := 1; index < len(steps); index++ {
+			timer := time.NewTimer(steps[index-1].Grace)
+
+			select {
+			case <-exe.exited:
+				timer.Stop()
+
+				return
+			case <-timer.C:
+			}
+
+			send(steps[index].Signal)
+		}
+	}()
+}
+
+func (exe *execution) setCancelSignal(sig os.Signal) {
+	exe.signalMutex.Lock()
+	defer exe.signalMutex.Unlock()
+
+	exe.cancelSignal = sig
+}
+
+func (exe *execution) getCancelSignal() os.Signal {
+	exe.signalMutex.Lock()
+	defer exe.signalMutex.Unlock()
+
+	return exe.cancelSignal
 }
@@ -19,11 +19,12 @@
 package com
 
 import (
+	"os"
 	"os/exec"
 	"syscall"
 )
 
-func addAttr(cmd *exec.Cmd) func() error {
+func addAttr(cmd *exec.Cmd) func(sig os.Signal) {
 	// Default shutdown will leave child processes behind in certain circumstances
 	cmd.SysProcAttr = &syscall.SysProcAttr{
 		Setsid: true,
@@ -31,9 +32,13 @@ func addAttr(cmd *exec.Cmd) func() error {
 		// Setctty: true,
 	}
 
-	return func() error {
-		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
-
-		return nil
+	return func(sig os.Signal) {
+		if sysSig, ok := sig.(syscall.Signal); ok {
+			_ = syscall.Kill(-cmd.Process.Pid, sysSig)
+		}
 	}
 }
+
+func notifyResize(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGWINCH)
+}
@@ -0,0 +1,98 @@
+//go:build !windows
+
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+package com_test
+
+import (
+	"context"
+	"math"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.farcloser.world/tigron/internal/assertive"
+	"go.farcloser.world/tigron/internal/com"
+)
+
+func TestLimitsCPU(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary:  "bash",
+		Args:    []string{"-c", "--", "while :; do :; done"},
+		Limits:  &com.Limits{CPUTime: time.Second},
+		Timeout: 10 * time.Second,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIs(t, err, com.ErrSignaled)
+	assertive.IsEqual(t, res.Signal, os.Signal(syscall.SIGXCPU))
+}
+
+func TestLimitsProcesses(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary:  "bash",
+		Args:    []string{"-c", "--", "ulimit -Su; ulimit -Hu"},
+		Limits:  &com.Limits{Processes: 100},
+		Timeout: 3 * time.Second,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	// Whatever the flag of the shell running the prelude (-u or -p), both limits are set
+	assertive.IsEqual(t, res.Stdout, "100\n100\n")
+}
+
+func TestLimitsAboveHard(t *testing.T) {
+	t.Parallel()
+
+	var current syscall.Rlimit
+
+	assertive.ErrorIsNil(t, syscall.Getrlimit(syscall.RLIMIT_NOFILE, &current))
+
+	//nolint:gosec,unconvert // Rlimit fields are int64 on freebsd
+	hard := uint64(current.Max)
+	if hard >= math.MaxInt64 {
+		t.Skip("there is no hard limit on open files")
+	}
+
+	command := &com.Command{
+		Binary:  "true",
+		Limits:  &com.Limits{OpenFiles: int64(hard) + 1},
+		Timeout: 3 * time.Second,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIs(t, err, com.ErrFailedStarting)
+	assertive.ErrorIs(t, err, com.ErrLimitsAboveHard)
+}
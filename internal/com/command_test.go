@@ -19,9 +19,12 @@ package com_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -249,6 +252,50 @@ func TestEnvBlacklist(t *testing.T) {
 	assertive.IsEqual(t, res.Stdout, "")
 }
 
+func TestEnvWhitelist(t *testing.T) {
+	t.Setenv("FOO", "BAR")
+	t.Setenv("FOOBAR", "BARBAR")
+	t.Setenv("TIGRON_ONE", "one")
+	t.Setenv("TIGRON_TWO", "two")
+
+	command := &com.Command{
+		Binary:               "env",
+		EnvWhiteList:         []string{"FOO", "PATH"},
+		EnvWhiteListPatterns: []*regexp.Regexp{regexp.MustCompile("^TIGRON_")},
+		EnvBlackListPatterns: []*regexp.Regexp{regexp.MustCompile("TWO$")},
+		EnvUnset:             []string{"PATH", "EXPLICIT_UNSET"},
+		Env: map[string]string{
+			"EXPLICIT":       "value",
+			"EXPLICIT_UNSET": "value",
+		},
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, res.ExitCode, 0)
+	assertive.StringContains(t, res.Stdout, "FOO=BAR")
+	assertive.StringContains(t, res.Stdout, "TIGRON_ONE=one")
+	assertive.StringContains(t, res.Stdout, "EXPLICIT=value")
+	assertive.StringDoesNotContain(t, res.Stdout, "FOOBAR=BARBAR")
+	assertive.StringDoesNotContain(t, res.Stdout, "TIGRON_TWO=two")
+	assertive.StringDoesNotContain(t, res.Stdout, "EXPLICIT_UNSET")
+
+	// On windows, with mingw, SYSTEMROOT,TERM and HOME (possibly others) will be forcefully added
+	// to the environment regardless
+	if runtime.GOOS == windows {
+		t.Skip(
+			"Windows/mingw will always repopulate the environment with extra variables we cannot bypass",
+		)
+	}
+
+	assertive.StringDoesNotContain(t, res.Stdout, "PATH=")
+}
+
 func TestEnvAdd(t *testing.T) {
 	t.Setenv("FOO", "BAR")
 	t.Setenv("BLED", "BLED")
@@ -445,6 +492,36 @@ func TestPTYBoth(t *testing.T) {
 	assertive.IsEqual(t, res.Stderr, "")
 }
 
+func TestPTYSeparateStderr(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == windows {
+		t.Skip("PTY are not supported on Windows")
+	}
+
+	command := &com.Command{
+		Binary: "bash",
+		Args: []string{
+			"-c", "--", "[ -t 1 ] && [ -t 2 ] || { echo not a pty; exit 41; }; printf onstdout; >&2 printf onstderr;",
+		},
+		Timeout: 1 * time.Second,
+	}
+
+	command.WithPTY(true, true, true)
+	command.WithSeparateStderrPTY()
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, res.ExitCode, 0)
+	assertive.IsEqual(t, res.Stdout, "onstdout")
+	assertive.IsEqual(t, res.Stderr, "onstderr")
+}
+
 func TestWriteStdin(t *testing.T) {
 	t.Parallel()
 
@@ -622,3 +699,921 @@ func TestSignalNormal(t *testing.T) {
 	assertive.IsEqual(t, res.Signal, usig)
 	assertive.IsEqual(t, res.ExitCode, -1)
 }
+
+func TestObserver(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary: "bash",
+		Args: []string{
+			"-c", "--",
+			">&2 printf 'err'; printf 'one\\ntwo\\n'; sleep 10",
+		},
+		Timeout: 3 * time.Second,
+	}
+
+	stdoutLines := make(chan string, 10)
+	stderrLines := make(chan string, 10)
+
+	command.WithObserver(com.Stdout, func() io.Writer {
+		return com.NewLineWriter(func(line string) {
+			stdoutLines <- line
+		})
+	})
+
+	command.WithObserver(com.Stderr, func() io.Writer {
+		return com.NewLineWriter(func(line string) {
+			stderrLines <- line
+		})
+	})
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	// Lines must be seen while the command is still running
+	for _, expected := range []string{"one", "two"} {
+		select {
+		case line := <-stdoutLines:
+			assertive.IsEqual(t, line, expected)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for stdout line", expected)
+		}
+	}
+
+	err = command.Signal(syscall.SIGKILL)
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIs(t, err, com.ErrSignaled)
+	assertive.IsEqual(t, res.Stdout, "one\ntwo\n")
+	assertive.IsEqual(t, res.Stderr, "err")
+
+	// Incomplete last line is flushed once the stream is closed
+	assertive.IsEqual(t, <-stderrLines, "err")
+}
+
+func TestDialog(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == windows {
+		t.Skip("PTY are not supported on Windows")
+	}
+
+	command := &com.Command{
+		Binary: "bash",
+		Args: []string{
+			"-c", "--",
+			"[ -t 0 ] || { echo not a pty; exit 41; }; read -p 'Name? ' name; read -p 'Sure [y/N] ' yn; " +
+				"printf 'hello %s %s' \"$name\" \"$yn\"",
+		},
+		Timeout: 3 * time.Second,
+	}
+
+	command.WithPTY(true, true, false)
+	command.WithDialog(
+		&com.DialogStep{
+			Expect: regexp.MustCompile(`Name\? $`),
+			Send:   "world\n",
+		},
+		&com.DialogStep{
+			Expect: regexp.MustCompile(`\[y/N\] $`),
+			Send:   "y\n",
+		},
+	)
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, res.ExitCode, 0)
+	assertive.IsEqual(t, res.Stdout, "hello world y")
+}
+
+func TestDialogFailure(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	command := &com.Command{
+		Binary: "bash",
+		Args: []string{
+			"-c", "--",
+			"printf 'Password: '; read pass; printf 'Confirm: '; read confirm",
+		},
+		Timeout: 3 * time.Second,
+	}
+
+	command.WithDialog(
+		&com.DialogStep{
+			Expect: regexp.MustCompile(`Password: `),
+			Send:   "secret\n",
+		},
+		&com.DialogStep{
+			Expect:  regexp.MustCompile(`Password again: `),
+			Send:    "secret\n",
+			Timeout: 500 * time.Millisecond,
+		},
+	)
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIs(t, err, com.ErrDialogFailed)
+	assertive.StringContains(t, err.Error(), "step 2")
+	// Only the output since the previous step is reported
+	assertive.StringContains(t, err.Error(), "output since the previous step was:\nConfirm: ")
+	assertive.IsEqual(t, res.Stdout, "Password: Confirm: ")
+	assertive.DurationIsLessThan(t, time.Since(start), 2*time.Second)
+}
+
+func TestDialogOutputLimit(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary:        "bash",
+		Args:          []string{"-c", "--", "head -c 100000 /dev/zero | tr '\\0' x; echo; sleep 3"},
+		MaxOutputSize: 1000,
+		Timeout:       5 * time.Second,
+	}
+
+	command.WithDialog(&com.DialogStep{
+		Expect:  regexp.MustCompile(`never`),
+		Timeout: 500 * time.Millisecond,
+	})
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	_, err = command.Wait()
+
+	assertive.ErrorIs(t, err, com.ErrDialogFailed)
+	// Only the end of the output is kept
+	assertive.True(t, len(err.Error()) < 2000, "the dialog should not keep the whole output")
+	assertive.StringContains(t, err.Error(), "xxx\n")
+}
+
+func TestTranscript(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary: "bash",
+		Args: []string{
+			"-c", "--",
+			"printf 'one\\n'; sleep 0.1; >&2 printf 'two\\n'; sleep 0.1; printf 'three\\n'",
+		},
+		Timeout: 3 * time.Second,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, len(res.Transcript), 3)
+	assertive.IsEqual(t, res.Transcript[0].Stream, com.Stdout)
+	assertive.IsEqual(t, string(res.Transcript[0].Data), "one\n")
+	assertive.IsEqual(t, res.Transcript[1].Stream, com.Stderr)
+	assertive.IsEqual(t, string(res.Transcript[1].Data), "two\n")
+	assertive.IsEqual(t, res.Transcript[2].Stream, com.Stdout)
+	assertive.IsEqual(t, string(res.Transcript[2].Data), "three\n")
+	assertive.True(t, res.Transcript[0].Elapsed < res.Transcript[1].Elapsed)
+	assertive.True(t, res.Transcript[1].Elapsed < res.Transcript[2].Elapsed)
+	assertive.StringContains(t, res.Transcript.String(), "stderr | two\n")
+}
+
+func TestMaxOutputSize(t *testing.T) {
+	t.Parallel()
+
+	spillDir := t.TempDir()
+	command := &com.Command{
+		Binary: "bash",
+		Args: []string{
+			"-c", "--",
+			"for i in $(seq 1 1000); do printf '0123456789'; done; >&2 printf small",
+		},
+		Timeout:       3 * time.Second,
+		MaxOutputSize: 100,
+		SpillDir:      spillDir,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.True(t, res.Truncated)
+	assertive.IsEqual(t, res.Stdout, strings.Repeat("0123456789", 10))
+	assertive.IsEqual(t, res.Stderr, "small")
+	assertive.IsEqual(t, res.StderrSpill, "")
+	assertive.StringHasPrefix(t, res.StdoutSpill, spillDir)
+
+	full, err := os.ReadFile(res.StdoutSpill)
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, string(full), strings.Repeat("0123456789", 1000))
+}
+
+func TestTimeoutEscalation(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == windows {
+		t.Skip("timeout escalation is not supported on windows")
+	}
+
+	start := time.Now()
+	command := &com.Command{
+		Binary:  "bash",
+		Args:    []string{"-c", "--", "trap 'printf cleanup; exit 3' TERM; printf one; sleep 5"},
+		Timeout: 1 * time.Second,
+		TimeoutEscalation: []*com.Escalation{
+			{Signal: syscall.SIGTERM, Grace: 2 * time.Second},
+		},
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	end := time.Now()
+
+	assertive.ErrorIs(t, err, com.ErrTimeout)
+	assertive.IsEqual(t, res.ExitCode, 3)
+	assertive.IsEqual(t, res.Stdout, "onecleanup")
+	assertive.IsEqual(t, res.CancelSignal, os.Signal(syscall.SIGTERM))
+	assertive.DurationIsLessThan(t, end.Sub(start), 2*time.Second)
+}
+
+func TestTimeoutEscalationKill(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == windows {
+		t.Skip("timeout escalation is not supported on windows")
+	}
+
+	start := time.Now()
+	command := &com.Command{
+		Binary: "bash",
+		Args: []string{
+			"-c", "--",
+			"trap 'printf ignored' TERM; printf one; for i in $(seq 1 50); do sleep 0.1; done",
+		},
+		Timeout: 1 * time.Second,
+		TimeoutEscalation: []*com.Escalation{
+			{Signal: syscall.SIGTERM, Grace: 500 * time.Millisecond},
+		},
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	end := time.Now()
+
+	assertive.ErrorIs(t, err, com.ErrTimeout)
+	assertive.IsEqual(t, res.ExitCode, -1)
+	assertive.IsEqual(t, res.Stdout, "oneignored")
+	assertive.IsEqual(t, res.CancelSignal, os.Kill)
+	assertive.DurationIsLessThan(t, end.Sub(start), 3*time.Second)
+}
+
+func TestResourceUsage(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary:  "bash",
+		Args:    []string{"-c", "--", "sleep 0.2; for i in $(seq 1 10000); do :; done"},
+		Timeout: 3 * time.Second,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.True(t, res.Duration >= 200*time.Millisecond, "duration should cover the sleep")
+	assertive.DurationIsLessThan(t, res.Duration, 3*time.Second)
+	assertive.True(t, res.UserTime+res.SystemTime > 0, "cpu time should have been recorded")
+
+	if runtime.GOOS != windows {
+		assertive.True(t, res.MaxRSS > 0, "max rss should have been recorded")
+	}
+}
+
+func TestOrphans(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("orphans detection is only supported on linux")
+	}
+
+	command := &com.Command{
+		Binary:  "bash",
+		Args:    []string{"-c", "--", "sleep 10 >/dev/null 2>&1 & printf done"},
+		Timeout: 3 * time.Second,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, res.Stdout, "done")
+	assertive.IsEqual(t, len(res.Orphans), 1)
+	assertive.StringHasPrefix(t, res.Orphans[0].Command, "sleep 10")
+
+	// syscall.Kill is not available on windows, where this does not run anyway
+	if orphan, err := os.FindProcess(res.Orphans[0].PID); err == nil {
+		_ = orphan.Kill()
+	}
+}
+
+func TestKillOrphans(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("orphans detection is only supported on linux")
+	}
+
+	command := &com.Command{
+		Binary:      "bash",
+		Args:        []string{"-c", "--", "sleep 10 >/dev/null 2>&1 & printf done"},
+		Timeout:     3 * time.Second,
+		KillOrphans: true,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, len(res.Orphans), 1)
+
+	// The process is gone, or a zombie waiting to be reaped
+	gone := false
+
+	for range 20 {
+		stat, err := os.ReadFile("/proc/" + strconv.Itoa(res.Orphans[0].PID) + "/stat")
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			gone = true
+
+			break
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	assertive.True(t, gone, "orphan should have been killed")
+}
+
+func TestCancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), com.LoggerKey, t))
+	command := &com.Command{
+		Binary:  "bash",
+		Args:    []string{"-c", "--", "printf one; sleep 1; sleep 1; printf two"},
+		Timeout: 5 * time.Second,
+	}
+
+	err := command.Run(ctx)
+
+	assertive.ErrorIsNil(t, err)
+
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+
+	res, err := command.Wait()
+
+	assertive.ErrorIs(t, err, com.ErrCancelled)
+	assertive.IsEqual(t, res.Stdout, "one")
+
+	if runtime.GOOS != windows {
+		assertive.IsEqual(t, res.CancelSignal, os.Kill)
+	}
+}
+
+func TestStdinStdoutFiles(t *testing.T) {
+	t.Parallel()
+
+	reader, writer, err := os.Pipe()
+
+	assertive.ErrorIsNil(t, err)
+
+	producer := &com.Command{
+		Binary:  "printf",
+		Args:    []string{"hello world"},
+		Timeout: 3 * time.Second,
+	}
+	producer.WithStdout(writer)
+
+	consumer := &com.Command{
+		Binary:  "cat",
+		Timeout: 3 * time.Second,
+	}
+	consumer.WithStdin(reader)
+
+	err = producer.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+	assertive.ErrorIsNil(t, err)
+
+	err = consumer.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+	assertive.ErrorIsNil(t, err)
+
+	// Our copies must be closed for the consumer to see the end of the stream
+	_ = reader.Close()
+	_ = writer.Close()
+
+	res, err := producer.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, res.Stdout, "")
+
+	res, err = consumer.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, res.Stdout, "hello world")
+}
+
+func TestDialogScriptedStdin(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary: "bash",
+		Args: []string{
+			"-c", "--",
+			"read -r a; echo \"got $a\"; read -r b; echo \"got $b\"; cat; echo eof",
+		},
+		Timeout: 3 * time.Second,
+	}
+
+	command.WithDialog(
+		&com.DialogStep{Send: "one\n"},
+		&com.DialogStep{Expect: regexp.MustCompile("got one"), Delay: 200 * time.Millisecond, Send: "two\n"},
+		&com.DialogStep{Expect: regexp.MustCompile("got two"), Send: "three", Close: true},
+		&com.DialogStep{Expect: regexp.MustCompile("eof")},
+	)
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, res.Stdout, "got one\ngot two\nthreeeof\n")
+	assertive.True(t, res.Duration >= 200*time.Millisecond, "delay should have been observed")
+}
+
+func TestDialogPTYClose(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == windows {
+		t.Skip("pty are not supported on windows")
+	}
+
+	// Interactive shells treat ^D as the end of input
+	command := &com.Command{
+		Binary:  "bash",
+		Args:    []string{"--norc", "--noprofile", "-i"},
+		Timeout: 3 * time.Second,
+	}
+
+	command.WithPTY(true, true, false)
+	command.WithDialog(
+		&com.DialogStep{Send: "echo hel''lo\n"},
+		&com.DialogStep{Expect: regexp.MustCompile("hello"), Close: true},
+	)
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.StringContains(t, res.Stdout, "hello")
+}
+
+func TestOpenStdin(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary:  "bash",
+		Args:    []string{"-c", "--", "read -r a; echo \"$a\"; read -r b || echo closed"},
+		Timeout: 1 * time.Second,
+	}
+
+	command.Feed(strings.NewReader("one\n"))
+	command.WithOpenStdin()
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIs(t, err, com.ErrTimeout)
+	assertive.IsEqual(t, res.Stdout, "one\n")
+}
+
+func TestWriteCloseStdin(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary:  "bash",
+		Args:    []string{"-c", "--", "read -r a; echo \"got $a\"; cat; echo eof"},
+		Timeout: 3 * time.Second,
+	}
+
+	_, err := command.Write([]byte("too early"))
+
+	assertive.ErrorIs(t, err, com.ErrExecNotStarted)
+
+	command.WithOpenStdin()
+
+	err = command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	_, err = command.Write([]byte("one\n"))
+
+	assertive.ErrorIsNil(t, err)
+
+	_, err = command.Write([]byte("two"))
+
+	assertive.ErrorIsNil(t, err)
+
+	err = command.CloseStdin()
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, res.Stdout, "got one\ntwoeof\n")
+}
+
+func TestWriteBlocked(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary:  "sleep",
+		Args:    []string{"5"},
+		Timeout: 10 * time.Second,
+	}
+
+	command.WithOpenStdin()
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	// Nothing reads stdin, so this blocks once the pipe is full
+	go func() {
+		_, _ = command.Write(make([]byte, 1024*1024))
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// A blocked writer must not prevent controlling the command
+	start := time.Now()
+	err = command.Signal(os.Kill)
+
+	assertive.ErrorIsNil(t, err)
+	assertive.DurationIsLessThan(t, time.Since(start), time.Second)
+
+	_, err = command.Wait()
+
+	assertive.ErrorIs(t, err, com.ErrSignaled)
+}
+
+func TestWriteNotOpen(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary:  "cat",
+		Timeout: 3 * time.Second,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	_, err = command.Write([]byte("data"))
+
+	assertive.ErrorIs(t, err, com.ErrStdinNotOpen)
+
+	_, err = command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+}
+
+func TestCancel(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary:  "bash",
+		Args:    []string{"-c", "--", "printf one; sleep 1; sleep 1; printf two"},
+		Timeout: 5 * time.Second,
+	}
+
+	// No effect before Run
+	command.Cancel()
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	time.Sleep(200 * time.Millisecond)
+	command.Cancel()
+
+	res, err := command.Wait()
+
+	assertive.ErrorIs(t, err, com.ErrCancelled)
+	assertive.IsEqual(t, res.Stdout, "one")
+}
+
+func TestCancelWhileWaiting(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary:  "sleep",
+		Args:    []string{"10"},
+		Timeout: 20 * time.Second,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	waited := make(chan error, 1)
+
+	go func() {
+		_, err := command.Wait()
+		waited <- err
+	}()
+
+	// Wait is now blocked on the process: Cancel must not be blocked by it
+	time.Sleep(200 * time.Millisecond)
+
+	cancelled := make(chan struct{})
+
+	go func() {
+		command.Cancel()
+		close(cancelled)
+	}()
+
+	select {
+	case <-cancelled:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Cancel should not be blocked by Wait")
+	}
+
+	select {
+	case err = <-waited:
+		assertive.ErrorIs(t, err, com.ErrCancelled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait should return once the command is cancelled")
+	}
+
+	// A second Wait reports the same outcome
+	_, err = command.Wait()
+
+	assertive.ErrorIs(t, err, com.ErrCancelled)
+}
+
+func TestExited(t *testing.T) {
+	t.Parallel()
+
+	command := &com.Command{
+		Binary:  "bash",
+		Args:    []string{"-c", "--", "sleep 0.2"},
+		Timeout: 3 * time.Second,
+	}
+
+	assertive.True(t, command.Exited() == nil, "Exited should be nil before Run")
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	select {
+	case <-command.Exited():
+		t.Fatal("command should still be running")
+	default:
+	}
+
+	select {
+	case <-command.Exited():
+	case <-time.After(2 * time.Second):
+		t.Fatal("command should have exited")
+	}
+
+	_, err = command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+}
+
+func TestPTYSize(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == windows {
+		t.Skip("pty are not supported on windows")
+	}
+
+	ready := make(chan struct{})
+
+	command := &com.Command{
+		Binary: "bash",
+		Args: []string{
+			"-c", "--",
+			"stty size; trap 'stty size; exit 0' WINCH; echo ready; while true; do sleep 0.05; done",
+		},
+		Timeout: 3 * time.Second,
+	}
+
+	command.WithPTY(true, true, false)
+	command.WithPTYSize(30, 100)
+	command.WithObserver(com.Stdout, func() io.Writer {
+		return com.NewLineWriter(func(line string) {
+			if line == "ready" {
+				close(ready)
+			}
+		})
+	})
+
+	err := command.Resize(10, 10)
+
+	assertive.ErrorIs(t, err, com.ErrExecNotStarted)
+
+	err = command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	<-ready
+
+	err = command.Resize(40, 132)
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, res.Stdout, "30 100\nready\n40 132\n")
+}
+
+func TestSandbox(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("sandboxing is only supported on linux")
+	}
+
+	workDir := t.TempDir()
+	keptDir := t.TempDir()
+	leaked := filepath.Join(os.TempDir(), "tigron-sandbox-"+strconv.Itoa(os.Getpid()))
+
+	assertive.ErrorIsNil(t, os.WriteFile(filepath.Join(workDir, "cwd"), []byte("cwd "), 0o600))
+	assertive.ErrorIsNil(t, os.WriteFile(filepath.Join(keptDir, "kept"), []byte("kept "), 0o600))
+
+	command := &com.Command{
+		Binary: "bash",
+		Args: []string{"-c", "--", fmt.Sprintf(
+			"cat cwd %q; touch %q; id -u; cat /proc/1/comm; grep -c : /proc/net/dev; ip link show lo | grep -o '<.*>'",
+			filepath.Join(keptDir, "kept"),
+			leaked,
+		)},
+		WorkingDir:   workDir,
+		SandboxPaths: []string{keptDir},
+		Sandbox:      true,
+		Timeout:      5 * time.Second,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+	skipWithoutUserNamespaces(t, err)
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	// Files are reachable, the user is root, the shell is the init process, and only the
+	// loopback interface is there, up
+	assertive.IsEqual(t, res.Stdout, "cwd kept 0\nsh\n1\n<LOOPBACK,UP,LOWER_UP>\n")
+
+	// Nothing written in /tmp made it to the host
+	_, err = os.Stat(leaked)
+	assertive.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestSandboxSignal(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS != "linux" {
+		t.Skip("sandboxing is only supported on linux")
+	}
+
+	command := &com.Command{
+		Binary:  "sleep",
+		Args:    []string{"10"},
+		Sandbox: true,
+		Timeout: 5 * time.Second,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+	skipWithoutUserNamespaces(t, err)
+
+	assertive.ErrorIsNil(t, err)
+
+	time.Sleep(200 * time.Millisecond)
+
+	err = command.Signal(syscall.SIGTERM)
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIs(t, err, com.ErrExecutionFailed)
+	assertive.IsEqual(t, res.ExitCode, 128+int(syscall.SIGTERM))
+}
+
+// skipWithoutUserNamespaces skips the test if the sandbox could not be created for lack of
+// permissions (eg: unprivileged user namespaces are disabled).
+func skipWithoutUserNamespaces(t *testing.T, err error) {
+	t.Helper()
+
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+		t.Skip("user namespaces are not available", err)
+	}
+}
+
+func TestSandboxNotSupported(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "linux" {
+		t.Skip("sandboxing is supported on linux")
+	}
+
+	command := &com.Command{
+		Binary:  "echo",
+		Sandbox: true,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIs(t, err, com.ErrFailedStarting)
+	assertive.ErrorIs(t, err, com.ErrSandboxNotSupported)
+}
+
+func TestLimits(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == windows {
+		t.Skip("resource limits are not supported on windows")
+	}
+
+	command := &com.Command{
+		Binary: "bash",
+		Args:   []string{"-c", "--", "ulimit -Sn; ulimit -Hn; ulimit -Sv; ulimit -Sc; ulimit -St; ulimit -Ht"},
+		Limits: &com.Limits{
+			OpenFiles:    64,
+			AddressSpace: 1 << 32,
+			CoreSize:     1024,
+			CPUTime:      10 * time.Second,
+		},
+		Timeout: 3 * time.Second,
+	}
+
+	err := command.Run(context.WithValue(context.Background(), com.LoggerKey, t))
+
+	assertive.ErrorIsNil(t, err)
+
+	res, err := command.Wait()
+
+	assertive.ErrorIsNil(t, err)
+	// Cores are set in blocks of 512 bytes, and reported by bash in blocks of 1024.
+	// Hard limits are set as well (one second above for CPU time, to get SIGXCPU).
+	assertive.IsEqual(t, res.Stdout, "64\n64\n4194304\n1\n10\n11\n")
+}
@@ -17,9 +17,12 @@
 package com
 
 import (
+	"os"
 	"os/exec"
 )
 
-func addAttr(_ *exec.Cmd) func() error {
+func addAttr(_ *exec.Cmd) func(sig os.Signal) {
 	return nil
 }
+
+func notifyResize(_ *exec.Cmd) {}
@@ -0,0 +1,263 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package com
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDialogTimeout = 5 * time.Second
+	// dialogReportSize is how much of the output (at most) a failed step reports.
+	dialogReportSize = 4096
+)
+
+// ErrDialogFailed is returned by Wait() if a dialog step did not see its expected output in time.
+var ErrDialogFailed = errors.New("dialog step failed")
+
+// DialogStep describes one exchange of a scripted conversation with a command: wait for Expect to
+// match the output, then wait for Delay, then write Send to stdin, and optionally close it.
+type DialogStep struct {
+	// Expect is matched against the output (stdout and stderr) produced since the previous step
+	// matched. If nil, Send is written right away.
+	Expect *regexp.Regexp
+	// Send is written to the command stdin once Expect has matched.
+	Send string
+	// Timeout is how long to wait for Expect to match (default to 5 seconds).
+	Timeout time.Duration
+	// Delay is how long to wait before writing Send (cut short if the command output ends).
+	Delay time.Duration
+	// Close closes stdin after Send has been written, so that the command sees EOF. As the pty is in
+	// raw mode, an EOF character (^D) is written instead, that interactive programs (shells, etc)
+	// understand as the end of input. Later steps may still expect output, but cannot send.
+	Close bool
+}
+
+// WithDialog scripts a conversation with the command. Steps are played in order, after any
+// content provided with Feed or WithFeeder has been written.
+// If a step does not see its expected output in time, the command is cancelled, and Wait will
+// return ErrDialogFailed, detailing which step failed and what the output was since the previous
+// step (its last 4KB).
+// Dialogs are typically used with a pty, to answer interactive prompts.
+// This command has no effect if Run has already been called.
+func (gc *Command) WithDialog(steps ...*DialogStep) {
+	gc.dialog = append(gc.dialog, steps...)
+}
+
+// dialog only holds the output produced since the last step matched (and, if limit is set, only
+// the last limit bytes of it).
+type dialog struct {
+	steps  []*DialogStep
+	abort  func()
+	mutex  sync.Mutex
+	output []byte
+	limit  int64
+	ended  bool
+	update chan struct{}
+	err    error
+}
+
+func newDialog(steps []*DialogStep, abort func(), limit int64) *dialog {
+	return &dialog{
+		steps:  steps,
+		abort:  abort,
+		limit:  limit,
+		update: make(chan struct{}, 1),
+	}
+}
+
+// observer returns a writer to be attached to an output stream of the command.
+// Closing the stdout observer signals that no more output is coming.
+func (dl *dialog) observer(stream Stream) func() io.Writer {
+	return func() io.Writer {
+		return &dialogObserver{
+			dialog: dl,
+			stream: stream,
+		}
+	}
+}
+
+func (dl *dialog) feeders() []func() io.Reader {
+	feeders := make([]func() io.Reader, 0, len(dl.steps))
+
+	for index := range dl.steps {
+		feeders = append(feeders, func() io.Reader {
+			return dl.play(index)
+		})
+	}
+
+	return feeders
+}
+
+func (dl *dialog) play(index int) io.Reader {
+	step := dl.steps[index]
+
+	if dl.failed() != nil {
+		return strings.NewReader("")
+	}
+
+	if step.Expect != nil {
+		if err := dl.await(index, step); err != nil {
+			dl.mutex.Lock()
+			dl.err = err
+			dl.mutex.Unlock()
+
+			dl.abort()
+
+			return strings.NewReader("")
+		}
+	}
+
+	if step.Delay > 0 {
+		dl.pause(step.Delay)
+	}
+
+	if step.Close {
+		return &endOfInput{Reader: strings.NewReader(step.Send)}
+	}
+
+	return strings.NewReader(step.Send)
+}
+
+// pause waits for the delay to expire, or the output to end, whichever comes first.
+func (dl *dialog) pause(delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		dl.mutex.Lock()
+		ended := dl.ended
+		dl.mutex.Unlock()
+
+		if ended {
+			return
+		}
+
+		select {
+		case <-dl.update:
+		case <-timer.C:
+			return
+		}
+	}
+}
+
+func (dl *dialog) await(index int, step *DialogStep) error {
+	timeout := step.Timeout
+	if timeout == 0 {
+		timeout = defaultDialogTimeout
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		dl.mutex.Lock()
+		loc := step.Expect.FindIndex(dl.output)
+
+		if loc != nil {
+			// Later steps only look at what comes next
+			dl.output = append([]byte(nil), dl.output[loc[1]:]...)
+			dl.mutex.Unlock()
+
+			return nil
+		}
+
+		ended := dl.ended
+		dl.mutex.Unlock()
+
+		if ended {
+			return dl.failure(index, step, "output ended")
+		}
+
+		select {
+		case <-dl.update:
+		case <-timer.C:
+			return dl.failure(index, step, "timed out after "+timeout.String())
+		}
+	}
+}
+
+func (dl *dialog) failure(index int, step *DialogStep, reason string) error {
+	dl.mutex.Lock()
+	defer dl.mutex.Unlock()
+
+	output := dl.output
+	if len(output) > dialogReportSize {
+		output = append([]byte("(truncated) ..."), output[len(output)-dialogReportSize:]...)
+	}
+
+	return fmt.Errorf(
+		"%w: step %d (%s) waiting for %q - output since the previous step was:\n%s",
+		ErrDialogFailed,
+		index+1,
+		reason,
+		step.Expect.String(),
+		string(output),
+	)
+}
+
+func (dl *dialog) failed() error {
+	dl.mutex.Lock()
+	defer dl.mutex.Unlock()
+
+	return dl.err
+}
+
+func (dl *dialog) notify() {
+	select {
+	case dl.update <- struct{}{}:
+	default:
+	}
+}
+
+type dialogObserver struct {
+	dialog *dialog
+	stream Stream
+}
+
+func (do *dialogObserver) Write(data []byte) (int, error) {
+	do.dialog.mutex.Lock()
+	do.dialog.output = append(do.dialog.output, data...)
+
+	if excess := int64(len(do.dialog.output)) - do.dialog.limit; do.dialog.limit > 0 && excess > 0 {
+		do.dialog.output = append([]byte(nil), do.dialog.output[excess:]...)
+	}
+
+	do.dialog.mutex.Unlock()
+
+	do.dialog.notify()
+
+	return len(data), nil
+}
+
+func (do *dialogObserver) Close() error {
+	if do.stream == Stdout {
+		do.dialog.mutex.Lock()
+		do.dialog.ended = true
+		do.dialog.mutex.Unlock()
+
+		do.dialog.notify()
+	}
+
+	return nil
+}
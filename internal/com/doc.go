@@ -20,6 +20,9 @@
 // - pty
 // - environment filtering
 // - stdin manipulation
-// - proper termination of the process group
+// - live observation of stdout and stderr, and a timestamped transcript of both
+// - scripted dialogs (expect / send)
+// - proper termination of the process group, and detection of orphaned processes (linux)
+// - sandboxing in linux namespaces, and resource limits
 // - wrapping commands and prepended args
 package com
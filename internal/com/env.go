@@ -0,0 +1,74 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package com
+
+import (
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// environ builds the environment of the command: host variables that pass the white and black
+// lists, then explicit Env, minus anything in EnvUnset.
+func (gc *Command) environ() []string {
+	env := []string{}
+
+	for _, envValue := range os.Environ() {
+		name, _, _ := strings.Cut(envValue, "=")
+
+		if gc.allowed(name) && !slices.Contains(gc.EnvUnset, name) {
+			env = append(env, envValue)
+		}
+	}
+
+	// Attach any explicit env we have
+	for k, v := range gc.Env {
+		if !slices.Contains(gc.EnvUnset, k) {
+			env = append(env, k+"="+v)
+		}
+	}
+
+	return env
+}
+
+// allowed tells whether a host variable should be passed along to the command.
+func (gc *Command) allowed(name string) bool {
+	if len(gc.EnvWhiteList) > 0 || len(gc.EnvWhiteListPatterns) > 0 {
+		if !slices.Contains(gc.EnvWhiteList, name) && !matchAny(gc.EnvWhiteListPatterns, name) {
+			return false
+		}
+	}
+
+	for _, b := range gc.EnvBlackList {
+		if b == "*" || b == name {
+			return false
+		}
+	}
+
+	return !matchAny(gc.EnvBlackListPatterns, name)
+}
+
+func matchAny(patterns []*regexp.Regexp, name string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,116 @@
+//go:build !windows
+
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package com
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	kilobyte  = 1024
+	blockSize = 512
+)
+
+// prelude returns the shell commands setting the limits.
+// Both the soft and hard limits are set, as commands may otherwise raise their soft limits back (Go
+// binaries do so for open files). The hard limit for CPU time is one second above the soft one, so
+// that the command gets SIGXCPU rather than SIGKILL.
+// Limits above the current hard limits cannot be set, and make cmd fail starting.
+func (lim *Limits) prelude(cmd *exec.Cmd) []string {
+	if err := lim.check(); err != nil && cmd.Err == nil {
+		cmd.Err = err
+	}
+
+	lines := []string{}
+
+	set := func(flag string, value int64) {
+		if value > 0 {
+			lines = append(lines, "ulimit -"+flag+" "+strconv.FormatInt(value, 10))
+		}
+	}
+
+	set("n", lim.OpenFiles)
+	set("v", ceilDiv(lim.AddressSpace, kilobyte))
+	set("c", ceilDiv(lim.CoreSize, blockSize))
+
+	if seconds := ceilDiv(int64(lim.CPUTime), int64(time.Second)); seconds > 0 {
+		// Soft first, as it cannot exceed the hard limit
+		lines = append(lines,
+			"ulimit -S -t "+strconv.FormatInt(seconds, 10),
+			"ulimit -H -t "+strconv.FormatInt(seconds+1, 10),
+		)
+	}
+
+	// Shells disagree on the flag for the number of processes: -u for bash, -p for dash (where bash
+	// uses -p for the pipe size, so, ask the shell whether it knows -u first)
+	if lim.Processes > 0 {
+		value := strconv.FormatInt(lim.Processes, 10)
+		lines = append(lines, "if ulimit -u >/dev/null 2>&1; then ulimit -u "+value+"; else ulimit -p "+value+"; fi")
+	}
+
+	return lines
+}
+
+// check verifies that the limits, as the prelude sets them, do not exceed the current hard limits.
+func (lim *Limits) check() error {
+	cpuTime := ceilDiv(int64(lim.CPUTime), int64(time.Second))
+	if cpuTime > 0 {
+		cpuTime++
+	}
+
+	requested := []struct {
+		name     string
+		resource int
+		value    int64
+	}{
+		{"open files", unix.RLIMIT_NOFILE, lim.OpenFiles},
+		{"address space", unix.RLIMIT_AS, ceilDiv(lim.AddressSpace, kilobyte) * kilobyte},
+		{"core size", unix.RLIMIT_CORE, ceilDiv(lim.CoreSize, blockSize) * blockSize},
+		{"cpu time", unix.RLIMIT_CPU, cpuTime},
+		{"processes", unix.RLIMIT_NPROC, lim.Processes},
+	}
+
+	for _, limit := range requested {
+		if limit.value <= 0 {
+			continue
+		}
+
+		var current unix.Rlimit
+		if err := unix.Getrlimit(limit.resource, &current); err != nil {
+			//nolint:wrapcheck
+			return err
+		}
+
+		//nolint:gosec,unconvert // Rlimit fields are int64 on freebsd, and RLIM_INFINITY does not overflow
+		if hard := uint64(current.Max); uint64(limit.value) > hard {
+			return fmt.Errorf("%w: %s %d (hard limit is %d)", ErrLimitsAboveHard, limit.name, limit.value, hard)
+		}
+	}
+
+	return nil
+}
+
+func ceilDiv(value, unit int64) int64 {
+	return (value + unit - 1) / unit
+}
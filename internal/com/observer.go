@@ -0,0 +1,120 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package com
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+
+	"go.farcloser.world/tigron/internal/logger"
+)
+
+// Stream identifies one of the output streams of a command.
+type Stream int
+
+const (
+	// Stdout designates the command standard output.
+	Stdout Stream = iota
+	// Stderr designates the command standard error.
+	Stderr
+)
+
+func (s Stream) String() string {
+	if s == Stderr {
+		return "stderr"
+	}
+
+	return "stdout"
+}
+
+// NewLineWriter returns a writer that splits whatever is written to it into lines, and calls the
+// provided function with each of them (trailing newline and carriage return removed).
+// Any incomplete last line is passed along when the writer is closed.
+func NewLineWriter(fun func(line string)) io.WriteCloser {
+	return &lineWriter{
+		fun: fun,
+	}
+}
+
+type lineWriter struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+	fun    func(line string)
+}
+
+func (lw *lineWriter) Write(data []byte) (int, error) {
+	lw.mutex.Lock()
+	defer lw.mutex.Unlock()
+
+	lw.buffer.Write(data)
+
+	for {
+		index := bytes.IndexByte(lw.buffer.Bytes(), '\n')
+		if index < 0 {
+			break
+		}
+
+		line := string(lw.buffer.Next(index + 1))
+		lw.fun(strings.TrimSuffix(line[:index], "\r"))
+	}
+
+	return len(data), nil
+}
+
+func (lw *lineWriter) Close() error {
+	lw.mutex.Lock()
+	defer lw.mutex.Unlock()
+
+	if lw.buffer.Len() > 0 {
+		lw.fun(strings.TrimSuffix(lw.buffer.String(), "\r"))
+		lw.buffer.Reset()
+	}
+
+	return nil
+}
+
+// broadcaster copies everything written to it to a main writer, and to a set of observers.
+// Observers failures are logged, but do not interrupt the copy to the main writer.
+type broadcaster struct {
+	main      io.Writer
+	observers []io.Writer
+	log       logger.Logger
+}
+
+func (bc *broadcaster) Write(data []byte) (int, error) {
+	written, err := bc.main.Write(data)
+
+	for _, observer := range bc.observers {
+		if _, obsErr := observer.Write(data); obsErr != nil {
+			bc.log.Log(" x observer failed writing", obsErr)
+		}
+	}
+
+	return written, err
+}
+
+func (bc *broadcaster) close() {
+	for _, observer := range bc.observers {
+		if closer, ok := observer.(io.Closer); ok {
+			if closeErr := closer.Close(); closeErr != nil {
+				bc.log.Log(" x failed closing observer", closeErr)
+			}
+		}
+	}
+}
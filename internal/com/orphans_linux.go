@@ -0,0 +1,99 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package com
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const procDir = "/proc"
+
+// findOrphans scans /proc for live processes belonging to the process group or session led by pid.
+func findOrphans(pid int) []*Orphan {
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return nil
+	}
+
+	var orphans []*Orphan
+
+	for _, entry := range entries {
+		candidate, err := strconv.Atoi(entry.Name())
+		if err != nil || candidate == pid {
+			continue
+		}
+
+		if !belongsTo(candidate, pid) {
+			continue
+		}
+
+		orphans = append(orphans, &Orphan{
+			PID:     candidate,
+			Command: processCommand(candidate),
+		})
+	}
+
+	return orphans
+}
+
+// belongsTo reads /proc/<pid>/stat and tells whether the (non-zombie) process is in the leader
+// process group or session.
+func belongsTo(pid, leader int) bool {
+	stat, err := os.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return false
+	}
+
+	// Format is "pid (comm) state ppid pgrp session ...", and comm may contain anything
+	closing := bytes.LastIndexByte(stat, ')')
+	if closing < 0 {
+		return false
+	}
+
+	fields := strings.Fields(string(stat[closing+1:]))
+	//nolint:mnd // state, ppid, pgrp, session
+	if len(fields) < 4 || fields[0] == "Z" {
+		return false
+	}
+
+	pgrp, _ := strconv.Atoi(fields[2])
+	session, _ := strconv.Atoi(fields[3])
+
+	return pgrp == leader || session == leader
+}
+
+func processCommand(pid int) string {
+	cmdline, err := os.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "cmdline"))
+	if err != nil || len(cmdline) == 0 {
+		comm, _ := os.ReadFile(filepath.Join(procDir, strconv.Itoa(pid), "comm"))
+
+		return strings.TrimSpace(string(comm))
+	}
+
+	return strings.TrimSpace(string(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '})))
+}
+
+func killOrphans(orphans []*Orphan) {
+	for _, orphan := range orphans {
+		_ = syscall.Kill(orphan.PID, syscall.SIGKILL)
+	}
+}
@@ -17,7 +17,6 @@
 package com
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -30,6 +29,9 @@ import (
 	"go.farcloser.world/tigron/internal/pty"
 )
 
+// eofCharacter is the default VEOF control character of terminals (^D).
+const eofCharacter = 0x04
+
 var (
 	// ErrFailedCreating could be returned by newStdPipes() on pty creation failure.
 	ErrFailedCreating = errors.New("failed acquiring pipe")
@@ -47,13 +49,19 @@ type pipe struct {
 }
 
 type stdPipes struct {
-	ioGroup    *errgroup.Group
-	stdin      *pipe
-	stdout     *pipe
-	stderr     *pipe
-	fromStdout string
-	fromStderr string
-	log        logger.Logger
+	ioGroup     *errgroup.Group
+	stdin       *pipe
+	stdout      *pipe
+	stderr      *pipe
+	fromStdout  string
+	fromStderr  string
+	stdoutSpill string
+	stderrSpill string
+	// Truncation of stdout and stderr
+	truncated [2]bool
+	// Pty masters, if any, for resizing
+	ptys []*os.File
+	log  logger.Logger
 }
 
 func (pipes *stdPipes) closeCallee() {
@@ -108,11 +116,25 @@ func (pipes *stdPipes) closeCaller() {
 	}
 }
 
+type pipesOptions struct {
+	ptyStdout         bool
+	ptyStderr         bool
+	ptyStdin          bool
+	ptySeparateStderr bool
+	writers           []func() io.Reader
+	openStdin         bool
+	ptyRows           uint16
+	ptyCols           uint16
+	stdoutObservers   []io.Writer
+	stderrObservers   []io.Writer
+	outputLimit       int64
+	spillDir          string
+}
+
 func newStdPipes(
 	ctx context.Context,
 	log *logger.ConcreteLogger,
-	ptyStdout, ptyStderr, ptyStdin bool,
-	writers []func() io.Reader,
+	opts *pipesOptions,
 ) (pipes *stdPipes, err error) {
 	// Close everything cleanly in case we errored
 	defer func() {
@@ -131,34 +153,60 @@ func newStdPipes(
 	}
 
 	var (
-		mty *os.File
-		tty *os.File
+		mty  *os.File
+		tty  *os.File
+		emty *os.File
+		etty *os.File
 	)
 
+	// Stderr gets its own pty only if it would otherwise share it with another stream
+	separateStderr := opts.ptyStderr && opts.ptySeparateStderr && (opts.ptyStdout || opts.ptyStdin)
+
 	// If we want a pty, configure it now
-	if ptyStdout || ptyStderr || ptyStdin {
+	if opts.ptyStdout || opts.ptyStdin || (opts.ptyStderr && !separateStderr) {
 		pipes.log.Log("<- opening pty")
 
-		mty, tty, err = pty.Open()
+		mty, tty, err = openRawPTY()
 		if err != nil {
 			pipes.log.Log(" x failed opening pty", err)
 
 			return nil, errors.Join(ErrFailedCreating, err)
 		}
+	}
+
+	if separateStderr {
+		pipes.log.Log("<- opening separate pty for stderr")
 
-		if _, err = term.MakeRaw(int(tty.Fd())); err != nil {
-			pipes.log.Log(" x failed making pty raw", err)
+		emty, etty, err = openRawPTY()
+		if err != nil {
+			pipes.log.Log(" x failed opening stderr pty", err)
+
+			// Do not leak the first pty, as it is not attached to pipes yet
+			_ = mty.Close()
+			_ = tty.Close()
 
 			return nil, errors.Join(ErrFailedCreating, err)
 		}
 	}
 
-	if ptyStdin {
+	for _, master := range []*os.File{mty, emty} {
+		if master != nil {
+			pipes.ptys = append(pipes.ptys, master)
+		}
+	}
+
+	if opts.ptyRows > 0 || opts.ptyCols > 0 {
+		if err = pipes.resize(opts.ptyRows, opts.ptyCols); err != nil {
+			pipes.log.Log(" x failed setting pty size", err)
+		}
+	}
+
+	if opts.ptyStdin {
 		pipes.log.Log("<- assigning pty to stdin")
 
 		pipes.stdin.writer = mty
 		pipes.stdin.reader = tty
-	} else if len(writers) > 0 {
+	} else if len(opts.writers) > 0 || opts.openStdin {
 		pipes.log.Log(" * assigning a pipe to stdin as we have writers")
 
 		// Only create a pipe for stdin if we intend on writing to stdin.
@@ -171,7 +219,7 @@ func newStdPipes(
 		}
 	}
 
-	if ptyStdout {
+	if opts.ptyStdout {
 		pipes.log.Log("<- assigning pty to stdout")
 
 		pipes.stdout.writer = tty
@@ -185,7 +233,12 @@ func newStdPipes(
 		}
 	}
 
-	if ptyStderr {
+	if separateStderr {
+		pipes.log.Log("<- assigning separate pty to stderr")
+
+		pipes.stderr.writer = etty
+		pipes.stderr.reader = emty
+	} else if opts.ptyStderr {
 		pipes.log.Log("<- assigning pty to stderr")
 
 		pipes.stderr.writer = tty
@@ -206,20 +259,38 @@ func newStdPipes(
 	pipes.ioGroup.Go(func() error {
 		pipes.log.Log("-> about to write to stdin")
 
-		for _, writer := range writers {
-			if _, copyErr := io.Copy(pipes.stdin.writer, writer()); copyErr != nil {
+		closed := false
+
+		for _, writer := range opts.writers {
+			reader := writer()
+
+			// Once stdin is closed, providers are still called (dialogs may be waiting on output),
+			// but there is nowhere to write anymore
+			if closed {
+				if count, _ := io.Copy(io.Discard, reader); count > 0 {
+					pipes.log.Log(" x stdin is closed, discarding bytes", count)
+				}
+
+				continue
+			}
+
+			if _, copyErr := io.Copy(pipes.stdin.writer, reader); copyErr != nil {
 				pipes.log.Log(" x failed writing to stdin", copyErr)
 
 				return errors.Join(ErrFailedWriting, copyErr)
 			}
+
+			if _, ok := reader.(*endOfInput); ok {
+				pipes.closeStdin(opts.ptyStdin)
+
+				closed = true
+			}
 		}
 
 		pipes.log.Log("<- done writing to stdin")
 
-		if !ptyStdin && pipes.stdin.writer != nil {
-			if closeErr := pipes.stdin.writer.Close(); closeErr != nil {
-				pipes.log.Log(" x failed closing caller stdin", closeErr)
-			}
+		if !closed && !opts.ptyStdin && !opts.openStdin && pipes.stdin.writer != nil {
+			pipes.closeStdin(false)
 		}
 
 		return nil
@@ -229,9 +300,13 @@ func newStdPipes(
 	pipes.ioGroup.Go(func() error {
 		pipes.log.Log("-> about to read stdout")
 
-		buf := &bytes.Buffer{}
-		_, copyErr := io.Copy(buf, pipes.stdout.reader)
-		pipes.fromStdout = buf.String()
+		capt := &capture{stream: Stdout, limit: opts.outputLimit, dir: opts.spillDir, log: pipes.log}
+		broad := &broadcaster{main: capt, observers: opts.stdoutObservers, log: pipes.log}
+		_, copyErr := io.Copy(broad, pipes.stdout.reader)
+		broad.close()
+		pipes.fromStdout = capt.buffer.String()
+		pipes.stdoutSpill = capt.close()
+		pipes.truncated[Stdout] = capt.truncated
 
 		if copyErr != nil {
 			pipes.log.Log(" x failed reading from stdout", copyErr)
@@ -249,9 +324,13 @@ func newStdPipes(
 		pipes.ioGroup.Go(func() error {
 			pipes.log.Log("-> about to read stderr")
 
-			buf := &bytes.Buffer{}
-			_, copyErr := io.Copy(buf, pipes.stderr.reader)
-			pipes.fromStderr = buf.String()
+			capt := &capture{stream: Stderr, limit: opts.outputLimit, dir: opts.spillDir, log: pipes.log}
+			broad := &broadcaster{main: capt, observers: opts.stderrObservers, log: pipes.log}
+			_, copyErr := io.Copy(broad, pipes.stderr.reader)
+			broad.close()
+			pipes.fromStderr = capt.buffer.String()
+			pipes.stderrSpill = capt.close()
+			pipes.truncated[Stderr] = capt.truncated
 
 			if copyErr != nil {
 				pipes.log.Log(" x failed reading from stderr", copyErr)
@@ -267,3 +346,53 @@ func newStdPipes(
 
 	return pipes, nil
 }
+
+func openRawPTY() (mty, tty *os.File, err error) {
+	mty, tty, err = pty.Open()
+	if err != nil {
+		return nil, nil, err //nolint:wrapcheck
+	}
+
+	if _, err = term.MakeRaw(int(tty.Fd())); err != nil {
+		_ = mty.Close()
+		_ = tty.Close()
+
+		return nil, nil, err //nolint:wrapcheck
+	}
+
+	return mty, tty, nil
+}
+
+// endOfInput is a reader after which stdin gets closed.
+type endOfInput struct {
+	io.Reader
+}
+
+// closeStdin signals the end of input to the command: for a pty, by sending an EOF character, as
+// closing it would also close the command output.
+func (pipes *stdPipes) closeStdin(pty bool) {
+	if pty {
+		if _, err := pipes.stdin.writer.Write([]byte{eofCharacter}); err != nil {
+			pipes.log.Log(" x failed sending EOF to pty stdin", err)
+		}
+
+		return
+	}
+
+	if closeErr := pipes.stdin.writer.Close(); closeErr != nil {
+		pipes.log.Log(" x failed closing caller stdin", closeErr)
+	}
+}
+
+// resize sets the window size of the ptys.
+func (pipes *stdPipes) resize(rows, cols uint16) error {
+	var errs []error
+
+	for _, master := range pipes.ptys {
+		if err := pty.SetSize(master, rows, cols); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
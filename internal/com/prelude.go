@@ -0,0 +1,53 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package com
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// withPrelude makes cmd run through a shell, that executes the prelude lines (aborting on failure)
+// before running the binary. If init is true, the shell does not get replaced by the binary, and
+// stays around as the init process of a sandbox.
+func withPrelude(cmd *exec.Cmd, prelude []string, init bool) {
+	// Do not mask a previous error (binary not found, etc)
+	if cmd.Err != nil {
+		return
+	}
+
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		cmd.Err = err
+
+		return
+	}
+
+	lines := append(append([]string{"set -e"}, prelude...), `exec "$0" "$@"`)
+	if init {
+		// Not the last command, so that the shell does not exec it: an init process ignores
+		// signals it does not handle, which would make the binary unkillable (but for SIGKILL)
+		lines[len(lines)-1] = `"$0" "$@"` + "\nexit $?"
+	}
+
+	cmd.Args = append([]string{shell, "-c", strings.Join(lines, "\n"), cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = shell
+}
+
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
@@ -0,0 +1,85 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package com
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+const (
+	sandboxTmp = "/tmp"
+	// sandboxStaging is where the private /tmp is prepared, before being moved in place. Since /proc
+	// gets remounted right after, it is as good a place as any.
+	sandboxStaging = "/proc"
+)
+
+// sandbox makes cmd run in new user, mount, pid, network and uts namespaces, mapping the current
+// user to root. It returns the prelude setting up the sandbox (see withPrelude): a private /tmp
+// (where paths remain reachable), a new /proc, and the loopback interface.
+func sandbox(cmd *exec.Cmd, paths []string) []string {
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+		syscall.CLONE_NEWNET | syscall.CLONE_NEWUTS
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+
+	// Without ip, the loopback interface would stay down
+	if _, err := exec.LookPath("ip"); err != nil && cmd.Err == nil {
+		cmd.Err = errors.Join(ErrSandboxUnavailable, err)
+	}
+
+	lines := []string{
+		"mount --make-rprivate /",
+		"mount -t tmpfs -o mode=1777 tigron " + sandboxStaging,
+	}
+
+	// Keep paths under /tmp, shortest first, skipping those already inside a kept one
+	paths = append([]string{cmd.Dir}, paths...)
+	kept := []string{}
+
+	slices.SortFunc(paths, func(a, b string) int { return len(a) - len(b) })
+
+	for _, path := range paths {
+		path = filepath.Clean(path)
+
+		rel, err := filepath.Rel(sandboxTmp, path)
+		if !filepath.IsAbs(path) || err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+
+		if slices.ContainsFunc(kept, func(parent string) bool {
+			return strings.HasPrefix(path, parent+string(filepath.Separator))
+		}) {
+			continue
+		}
+
+		kept = append(kept, path)
+		staged := quote(filepath.Join(sandboxStaging, rel))
+		lines = append(lines, "mkdir -p "+staged, "mount --bind "+quote(path)+" "+staged)
+	}
+
+	return append(lines,
+		"mount --move "+sandboxStaging+" "+sandboxTmp,
+		"mount -t proc proc /proc",
+		"ip link set lo up",
+	)
+}
@@ -0,0 +1,118 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package com
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Chunk is a piece of output, as read from one of the command streams.
+type Chunk struct {
+	Stream Stream
+	// Elapsed is the (monotonic) time elapsed between the start of the command and the chunk being
+	// read.
+	Elapsed time.Duration
+	Data    []byte
+}
+
+// Transcript is the combined output of a command, as a list of chunks in the order they were read,
+// across both stdout and stderr.
+// If Command.MaxOutputSize is set, recording of a stream stops once it has exceeded that size.
+type Transcript []*Chunk
+
+// String renders the transcript line by line, each line prefixed with its timestamp and stream.
+func (tr Transcript) String() string {
+	var builder strings.Builder
+
+	for _, chunk := range tr {
+		lines := strings.SplitAfter(string(chunk.Data), "\n")
+		for _, line := range lines {
+			if line == "" {
+				continue
+			}
+
+			_, _ = fmt.Fprintf(
+				&builder,
+				"%12s %-6s | %s",
+				chunk.Elapsed.Round(time.Microsecond),
+				chunk.Stream,
+				line,
+			)
+
+			if !strings.HasSuffix(line, "\n") {
+				builder.WriteString("\n")
+			}
+		}
+	}
+
+	return builder.String()
+}
+
+type transcriber struct {
+	mutex  sync.Mutex
+	start  time.Time
+	chunks Transcript
+	// If limit is set, recording stops for a stream once it has exceeded limit bytes
+	limit int64
+	sizes [2]int64
+}
+
+func (tc *transcriber) observer(stream Stream) func() io.Writer {
+	return func() io.Writer {
+		return &transcriberObserver{
+			transcriber: tc,
+			stream:      stream,
+		}
+	}
+}
+
+func (tc *transcriber) transcript() Transcript {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+
+	return append(Transcript(nil), tc.chunks...)
+}
+
+type transcriberObserver struct {
+	transcriber *transcriber
+	stream      Stream
+}
+
+func (to *transcriberObserver) Write(data []byte) (int, error) {
+	to.transcriber.mutex.Lock()
+	defer to.transcriber.mutex.Unlock()
+
+	if to.transcriber.limit > 0 {
+		if to.transcriber.sizes[to.stream] >= to.transcriber.limit {
+			return len(data), nil
+		}
+
+		to.transcriber.sizes[to.stream] += int64(len(data))
+	}
+
+	to.transcriber.chunks = append(to.transcriber.chunks, &Chunk{
+		Stream:  to.stream,
+		Elapsed: time.Since(to.transcriber.start),
+		Data:    append([]byte(nil), data...),
+	})
+
+	return len(data), nil
+}
@@ -0,0 +1,34 @@
+//go:build !windows && !darwin
+
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package com
+
+import (
+	"os"
+	"syscall"
+)
+
+// maxRSS returns the peak resident set size in bytes. Linux and BSDs report it in kilobytes.
+func maxRSS(state *os.ProcessState) int64 {
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		//nolint:unconvert // Maxrss type varies across platforms
+		return int64(usage.Maxrss) * 1024
+	}
+
+	return 0
+}
@@ -14,7 +14,8 @@
    limitations under the License.
 */
 
-// Package internal provides an assert library, pty, a command wrapper, and a leak detection library
+// Package internal provides an assert library, pty, a command wrapper, a virtual terminal, and a leak
+// detection library
 // for internal use in Tigron.
 // The objective for these is not to become generic use-cases libraries, but instead to deliver what
 // Tigron needs
@@ -28,5 +29,5 @@ const (
 	ExitCodeNoCheck     = -11
 	ExitCodeTimeout     = -12
 	ExitCodeSignaled    = -13
-	// ExitCodeCancelled = -14.
+	ExitCodeCancelled   = -14
 )
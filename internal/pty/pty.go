@@ -24,7 +24,7 @@ import (
 var (
 	// ErrFailure is wrapping system pty creation failure returned by Open().
 	ErrFailure = errors.New("pty failure")
-	// ErrUnsupportedPlatform is returned by Open() on unsupported platforms.
+	// ErrUnsupportedPlatform is returned by Open() and SetSize() on unsupported platforms.
 	ErrUnsupportedPlatform = errors.New("pty not supported on this platform")
 )
 
@@ -32,3 +32,8 @@ var (
 func Open() (pty, tty *os.File, err error) {
 	return popen()
 }
+
+// SetSize sets the window size (rows and columns) of a pty.
+func SetSize(pty *os.File, rows, cols uint16) error {
+	return setsize(pty, rows, cols)
+}
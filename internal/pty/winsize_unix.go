@@ -0,0 +1,64 @@
+//go:build linux || darwin || freebsd
+
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package pty
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+type winsize struct {
+	rows uint16
+	cols uint16
+	x    uint16
+	y    uint16
+}
+
+func setsize(pty *os.File, rows, cols uint16) error {
+	conn, err := pty.SyscallConn()
+	if err != nil {
+		return errors.Join(ErrFailure, err)
+	}
+
+	size := &winsize{rows: rows, cols: cols}
+
+	var sysErr syscall.Errno
+
+	// Control does not switch the file to blocking mode, unlike Fd()
+	err = conn.Control(func(fd uintptr) {
+		//nolint:gosec
+		_, _, sysErr = syscall.Syscall(
+			syscall.SYS_IOCTL,
+			fd,
+			syscall.TIOCSWINSZ,
+			uintptr(unsafe.Pointer(size)),
+		)
+	})
+	if err != nil {
+		return errors.Join(ErrFailure, err)
+	}
+
+	if sysErr != 0 {
+		return errors.Join(ErrFailure, sysErr)
+	}
+
+	return nil
+}
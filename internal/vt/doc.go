@@ -0,0 +1,23 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package vt is a minimal virtual terminal (a subset of VT100 / xterm), that replays the output of
+// a program into a grid of cells, so that one can verify what a user would actually see.
+// It understands cursor movements, erasing, scrolling regions, insertion and deletion, the
+// alternate screen, and ignores attributes (colors, etc), as well as any other sequence.
+// All characters are assumed to be one cell wide.
+// It is not meant to be public and is here solely to serve tigron internal needs.
+package vt
@@ -0,0 +1,581 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package vt
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	tabWidth   = 8
+	maxParams  = 16
+	maxParam   = 65535
+	blank      = ' '
+	escape     = 0x1b
+	controlDEL = 0x7f
+)
+
+type state int
+
+const (
+	stateGround state = iota
+	stateEscape
+	stateCharset
+	stateCSI
+	stateOSC
+	stateString
+	stateStringEscape
+)
+
+type cursor struct {
+	row int
+	col int
+}
+
+// Screen is a virtual terminal screen. It implements io.Writer.
+type Screen struct {
+	// NewLineMode makes line feeds also return the cursor to the first column (like the terminal
+	// driver would with ONLCR, or a terminal in LNM mode).
+	NewLineMode bool
+
+	rows  int
+	cols  int
+	cells [][]rune
+	// alternate holds the main screen while the alternate one is in use
+	alternate [][]rune
+
+	cursor      cursor
+	saved       cursor
+	wrapPending bool
+	autoWrap    bool
+	hidden      bool
+	top         int
+	bottom      int
+
+	state   state
+	params  []int
+	private bool
+	partial []byte
+}
+
+// New returns a blank screen of the given size.
+func New(rows, cols int) *Screen {
+	screen := &Screen{
+		rows:     max(rows, 1),
+		cols:     max(cols, 1),
+		autoWrap: true,
+	}
+
+	screen.reset()
+
+	return screen
+}
+
+// Write interprets data (text and control sequences) onto the screen. It never fails.
+func (sc *Screen) Write(data []byte) (int, error) {
+	// Finish any multibyte character split across writes
+	buf := append(sc.partial, data...)
+	sc.partial = nil
+
+	for len(buf) > 0 {
+		char := buf[0]
+
+		if sc.state != stateGround || char < utf8.RuneSelf {
+			sc.interpret(char)
+
+			buf = buf[1:]
+
+			continue
+		}
+
+		if !utf8.FullRune(buf) {
+			sc.partial = append([]byte(nil), buf...)
+
+			break
+		}
+
+		decoded, size := utf8.DecodeRune(buf)
+		sc.print(decoded)
+
+		buf = buf[size:]
+	}
+
+	return len(data), nil
+}
+
+// Row returns the text of a row (starting at zero), without trailing blanks.
+func (sc *Screen) Row(row int) string {
+	if row < 0 || row >= sc.rows {
+		return ""
+	}
+
+	return strings.TrimRight(string(sc.cells[row]), string(blank))
+}
+
+// Cell returns the character at a position (starting at zero), or a blank if out of bounds.
+func (sc *Screen) Cell(row, col int) rune {
+	if row < 0 || row >= sc.rows || col < 0 || col >= sc.cols {
+		return blank
+	}
+
+	return sc.cells[row][col]
+}
+
+// Cursor returns the position of the cursor (starting at zero).
+func (sc *Screen) Cursor() (row, col int) {
+	return sc.cursor.row, sc.cursor.col
+}
+
+// CursorVisible tells whether the cursor has been hidden by the program.
+func (sc *Screen) CursorVisible() bool {
+	return !sc.hidden
+}
+
+// Size returns the number of rows and columns of the screen.
+func (sc *Screen) Size() (rows, cols int) {
+	return sc.rows, sc.cols
+}
+
+// String returns all rows, without trailing blanks, and without trailing empty rows.
+func (sc *Screen) String() string {
+	lines := make([]string, sc.rows)
+	for index := range sc.rows {
+		lines[index] = sc.Row(index)
+	}
+
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+func (sc *Screen) reset() {
+	sc.cells = sc.blankGrid()
+	sc.alternate = nil
+	sc.cursor = cursor{}
+	sc.saved = cursor{}
+	sc.wrapPending = false
+	sc.autoWrap = true
+	sc.hidden = false
+	sc.top = 0
+	sc.bottom = sc.rows - 1
+	sc.state = stateGround
+}
+
+func (sc *Screen) blankGrid() [][]rune {
+	grid := make([][]rune, sc.rows)
+	for index := range grid {
+		grid[index] = sc.blankRow()
+	}
+
+	return grid
+}
+
+func (sc *Screen) blankRow() []rune {
+	row := make([]rune, sc.cols)
+	for index := range row {
+		row[index] = blank
+	}
+
+	return row
+}
+
+func (sc *Screen) interpret(char byte) {
+	switch sc.state {
+	case stateGround:
+		sc.ground(char)
+	case stateEscape:
+		sc.escape(char)
+	case stateCharset:
+		// Character set designation - ignored
+		sc.state = stateGround
+	case stateCSI:
+		sc.csi(char)
+	case stateOSC:
+		// Operating system commands end with BEL or ST
+		switch char {
+		case '\a':
+			sc.state = stateGround
+		case escape:
+			sc.state = stateStringEscape
+		}
+	case stateString:
+		if char == escape {
+			sc.state = stateStringEscape
+		}
+	case stateStringEscape:
+		// ESC \ (ST) ends the string - anything else is ignored along
+		sc.state = stateGround
+	}
+}
+
+func (sc *Screen) ground(char byte) {
+	switch char {
+	case escape:
+		sc.state = stateEscape
+	case '\r':
+		sc.moveTo(sc.cursor.row, 0)
+	case '\n', '\v', '\f':
+		sc.lineFeed()
+
+		if sc.NewLineMode {
+			sc.moveTo(sc.cursor.row, 0)
+		}
+	case '\b':
+		sc.moveTo(sc.cursor.row, sc.cursor.col-1)
+	case '\t':
+		sc.moveTo(sc.cursor.row, min((sc.cursor.col/tabWidth+1)*tabWidth, sc.cols-1))
+	default:
+		// Other control characters (BEL, SO, SI, etc) are ignored
+		if char >= ' ' && char != controlDEL {
+			sc.print(rune(char))
+		}
+	}
+}
+
+func (sc *Screen) escape(char byte) {
+	sc.state = stateGround
+
+	switch char {
+	case '[':
+		sc.state = stateCSI
+		sc.params = sc.params[:0]
+		sc.private = false
+	case ']':
+		sc.state = stateOSC
+	case 'P', 'X', '^', '_':
+		sc.state = stateString
+	case '(', ')', '*', '+', '#', '%':
+		sc.state = stateCharset
+	case '7':
+		sc.saved = sc.cursor
+	case '8':
+		sc.moveTo(sc.saved.row, sc.saved.col)
+	case 'D':
+		sc.lineFeed()
+	case 'E':
+		sc.lineFeed()
+		sc.moveTo(sc.cursor.row, 0)
+	case 'M':
+		sc.reverseLineFeed()
+	case 'c':
+		sc.reset()
+	}
+}
+
+func (sc *Screen) csi(char byte) {
+	switch {
+	case char >= '0' && char <= '9':
+		if len(sc.params) == 0 {
+			sc.params = append(sc.params, 0)
+		}
+
+		last := len(sc.params) - 1
+		sc.params[last] = min(sc.params[last]*10+int(char-'0'), maxParam)
+	case char == ';' || char == ':':
+		if len(sc.params) == 0 {
+			sc.params = append(sc.params, 0)
+		}
+
+		if len(sc.params) < maxParams {
+			sc.params = append(sc.params, 0)
+		}
+	case char == '?' || char == '>' || char == '=' || char == '<':
+		sc.private = true
+	case char >= 0x40 && char <= 0x7e:
+		sc.state = stateGround
+		sc.dispatch(char)
+	case char >= ' ':
+		// Intermediate bytes are ignored
+	default:
+		// Control characters are executed in the middle of sequences
+		sc.ground(char)
+
+		if sc.state == stateGround {
+			sc.state = stateCSI
+		}
+	}
+}
+
+// param returns the parameter at index, or def if missing or zero.
+func (sc *Screen) param(index, def int) int {
+	if index >= len(sc.params) || sc.params[index] == 0 {
+		return def
+	}
+
+	return sc.params[index]
+}
+
+//nolint:cyclop,gocyclo,funlen // This is a flat list of sequences
+func (sc *Screen) dispatch(final byte) {
+	if sc.private {
+		switch final {
+		case 'h':
+			sc.setPrivateModes(true)
+		case 'l':
+			sc.setPrivateModes(false)
+		}
+
+		return
+	}
+
+	row, col := sc.cursor.row, sc.cursor.col
+
+	switch final {
+	case 'A':
+		sc.moveTo(max(row-sc.param(0, 1), min(row, sc.top)), col)
+	case 'B', 'e':
+		sc.moveTo(min(row+sc.param(0, 1), max(row, sc.bottom)), col)
+	case 'C', 'a':
+		sc.moveTo(row, col+sc.param(0, 1))
+	case 'D':
+		sc.moveTo(row, col-sc.param(0, 1))
+	case 'E':
+		sc.moveTo(row+sc.param(0, 1), 0)
+	case 'F':
+		sc.moveTo(row-sc.param(0, 1), 0)
+	case 'G', '`':
+		sc.moveTo(row, sc.param(0, 1)-1)
+	case 'd':
+		sc.moveTo(sc.param(0, 1)-1, col)
+	case 'H', 'f':
+		sc.moveTo(sc.param(0, 1)-1, sc.param(1, 1)-1)
+	case 'J':
+		sc.eraseDisplay(sc.param(0, 0))
+	case 'K':
+		sc.eraseLine(sc.param(0, 0))
+	case 'X':
+		sc.clear(row, col, min(col+sc.param(0, 1), sc.cols))
+	case '@':
+		sc.insertChars(sc.param(0, 1))
+	case 'P':
+		sc.deleteChars(sc.param(0, 1))
+	case 'L':
+		sc.insertLines(sc.param(0, 1))
+	case 'M':
+		sc.deleteLines(sc.param(0, 1))
+	case 'S':
+		sc.scrollUp(sc.top, sc.bottom, sc.param(0, 1))
+	case 'T':
+		sc.scrollDown(sc.top, sc.bottom, sc.param(0, 1))
+	case 'r':
+		top, bottom := sc.param(0, 1)-1, sc.param(1, sc.rows)-1
+		if top < bottom && bottom < sc.rows {
+			sc.top, sc.bottom = top, bottom
+			sc.moveTo(0, 0)
+		}
+	case 's':
+		sc.saved = sc.cursor
+	case 'u':
+		sc.moveTo(sc.saved.row, sc.saved.col)
+	case 'h', 'l':
+		for index := range sc.params {
+			// Automatic new line (LNM)
+			if sc.params[index] == 20 {
+				sc.NewLineMode = final == 'h'
+			}
+		}
+	}
+	// Anything else (including attributes - m) is ignored
+}
+
+func (sc *Screen) setPrivateModes(enable bool) {
+	for _, mode := range sc.params {
+		switch mode {
+		case 7:
+			sc.autoWrap = enable
+		case 25:
+			sc.hidden = !enable
+		case 47, 1047, 1049:
+			sc.switchScreen(enable, mode == 1049)
+		}
+	}
+}
+
+func (sc *Screen) switchScreen(alternate, saveCursor bool) {
+	switch {
+	case alternate && sc.alternate == nil:
+		if saveCursor {
+			sc.saved = sc.cursor
+		}
+
+		sc.alternate = sc.cells
+		sc.cells = sc.blankGrid()
+	case !alternate && sc.alternate != nil:
+		sc.cells = sc.alternate
+		sc.alternate = nil
+
+		if saveCursor {
+			sc.moveTo(sc.saved.row, sc.saved.col)
+		}
+	}
+}
+
+func (sc *Screen) print(char rune) {
+	if sc.wrapPending {
+		sc.lineFeed()
+		sc.moveTo(sc.cursor.row, 0)
+	}
+
+	sc.cells[sc.cursor.row][sc.cursor.col] = char
+
+	if sc.cursor.col == sc.cols-1 {
+		sc.wrapPending = sc.autoWrap
+	} else {
+		sc.cursor.col++
+	}
+}
+
+func (sc *Screen) moveTo(row, col int) {
+	sc.cursor.row = min(max(row, 0), sc.rows-1)
+	sc.cursor.col = min(max(col, 0), sc.cols-1)
+	sc.wrapPending = false
+}
+
+func (sc *Screen) lineFeed() {
+	if sc.cursor.row == sc.bottom {
+		sc.scrollUp(sc.top, sc.bottom, 1)
+	} else if sc.cursor.row < sc.rows-1 {
+		sc.cursor.row++
+	}
+
+	sc.wrapPending = false
+}
+
+func (sc *Screen) reverseLineFeed() {
+	if sc.cursor.row == sc.top {
+		sc.scrollDown(sc.top, sc.bottom, 1)
+	} else if sc.cursor.row > 0 {
+		sc.cursor.row--
+	}
+
+	sc.wrapPending = false
+}
+
+// scrollUp moves rows between top and bottom (included) up, and blanks the ones at the bottom.
+func (sc *Screen) scrollUp(top, bottom, count int) {
+	count = min(count, bottom-top+1)
+
+	copy(sc.cells[top:bottom+1], sc.cells[top+count:bottom+1])
+
+	for index := bottom - count + 1; index <= bottom; index++ {
+		sc.cells[index] = sc.blankRow()
+	}
+}
+
+// scrollDown moves rows between top and bottom (included) down, and blanks the ones at the top.
+func (sc *Screen) scrollDown(top, bottom, count int) {
+	count = min(count, bottom-top+1)
+
+	copy(sc.cells[top+count:bottom+1], sc.cells[top:bottom+1-count])
+
+	for index := top; index < top+count; index++ {
+		sc.cells[index] = sc.blankRow()
+	}
+}
+
+func (sc *Screen) insertLines(count int) {
+	if sc.cursor.row < sc.top || sc.cursor.row > sc.bottom {
+		return
+	}
+
+	sc.scrollDown(sc.cursor.row, sc.bottom, count)
+	sc.moveTo(sc.cursor.row, 0)
+}
+
+func (sc *Screen) deleteLines(count int) {
+	if sc.cursor.row < sc.top || sc.cursor.row > sc.bottom {
+		return
+	}
+
+	sc.scrollUp(sc.cursor.row, sc.bottom, count)
+	sc.moveTo(sc.cursor.row, 0)
+}
+
+func (sc *Screen) insertChars(count int) {
+	line := sc.cells[sc.cursor.row]
+	count = min(count, sc.cols-sc.cursor.col)
+
+	copy(line[sc.cursor.col+count:], line[sc.cursor.col:])
+	sc.clear(sc.cursor.row, sc.cursor.col, sc.cursor.col+count)
+	sc.wrapPending = false
+}
+
+func (sc *Screen) deleteChars(count int) {
+	line := sc.cells[sc.cursor.row]
+	count = min(count, sc.cols-sc.cursor.col)
+
+	copy(line[sc.cursor.col:], line[sc.cursor.col+count:])
+	sc.clear(sc.cursor.row, sc.cols-count, sc.cols)
+	sc.wrapPending = false
+}
+
+// clear blanks the cells of a row between from (included) and to (excluded).
+func (sc *Screen) clear(row, from, to int) {
+	for col := from; col < to; col++ {
+		sc.cells[row][col] = blank
+	}
+}
+
+func (sc *Screen) eraseLine(mode int) {
+	row, col := sc.cursor.row, sc.cursor.col
+
+	switch mode {
+	case 0:
+		sc.clear(row, col, sc.cols)
+	case 1:
+		sc.clear(row, 0, col+1)
+	case 2:
+		sc.clear(row, 0, sc.cols)
+	}
+}
+
+func (sc *Screen) eraseDisplay(mode int) {
+	row := sc.cursor.row
+
+	switch mode {
+	case 0:
+		sc.eraseLine(0)
+
+		for index := row + 1; index < sc.rows; index++ {
+			sc.cells[index] = sc.blankRow()
+		}
+	case 1:
+		sc.eraseLine(1)
+
+		for index := range row {
+			sc.cells[index] = sc.blankRow()
+		}
+	case 2, 3:
+		sc.cells = sc.blankGrid()
+	}
+}
+
+// GoString returns a representation of the screen, framed, with the cursor position, which is
+// convenient for debugging.
+func (sc *Screen) GoString() string {
+	border := "+" + strings.Repeat("-", sc.cols) + "+"
+	lines := []string{border}
+
+	for _, row := range sc.cells {
+		lines = append(lines, "|"+string(row)+"|")
+	}
+
+	lines = append(lines, border,
+		"cursor: row "+strconv.Itoa(sc.cursor.row)+", col "+strconv.Itoa(sc.cursor.col))
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,188 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+package vt_test
+
+import (
+	"testing"
+
+	"go.farcloser.world/tigron/internal/assertive"
+	"go.farcloser.world/tigron/internal/vt"
+)
+
+func write(screen *vt.Screen, data string) {
+	_, _ = screen.Write([]byte(data))
+}
+
+func TestScreenText(t *testing.T) {
+	t.Parallel()
+
+	screen := vt.New(3, 10)
+	screen.NewLineMode = true
+
+	write(screen, "hello\nworld")
+	assertive.IsEqual(t, screen.Row(0), "hello")
+	assertive.IsEqual(t, screen.Row(1), "world")
+	assertive.IsEqual(t, screen.String(), "hello\nworld")
+
+	row, col := screen.Cursor()
+	assertive.IsEqual(t, row, 1)
+	assertive.IsEqual(t, col, 5)
+
+	// Overwrite with carriage return, backspace and tabs
+	write(screen, "\rW\bw\tx")
+	assertive.IsEqual(t, screen.Row(1), "world   x")
+}
+
+func TestScreenLineFeedWithoutNewLineMode(t *testing.T) {
+	t.Parallel()
+
+	screen := vt.New(3, 10)
+
+	write(screen, "ab\ncd")
+	assertive.IsEqual(t, screen.String(), "ab\n  cd")
+}
+
+func TestScreenWrapAndScroll(t *testing.T) {
+	t.Parallel()
+
+	screen := vt.New(2, 4)
+
+	// Wrapping is deferred until the next character
+	write(screen, "abcd")
+	row, col := screen.Cursor()
+	assertive.IsEqual(t, row, 0)
+	assertive.IsEqual(t, col, 3)
+
+	write(screen, "efghij")
+	assertive.IsEqual(t, screen.String(), "efgh\nij")
+
+	// Without autowrap, the last column gets overwritten
+	write(screen, "\x1b[?7l\x1b[1;1Hwxyz!")
+	assertive.IsEqual(t, screen.Row(0), "wxy!")
+}
+
+func TestScreenCursorAndErase(t *testing.T) {
+	t.Parallel()
+
+	screen := vt.New(4, 10)
+	screen.NewLineMode = true
+
+	write(screen, "line1\nline2\nline3\nline4")
+
+	// Absolute move, erase to end of line
+	write(screen, "\x1b[2;3H\x1b[K")
+	assertive.IsEqual(t, screen.Row(1), "li")
+
+	// Relative moves, erase start of line
+	write(screen, "\x1b[B\x1b[1C\x1b[1K")
+	assertive.IsEqual(t, screen.Row(2), "    3")
+
+	// Erase below
+	write(screen, "\x1b[J")
+	assertive.IsEqual(t, screen.Row(3), "")
+
+	// Save and restore, then erase everything
+	write(screen, "\x1b7\x1b[H\x1b8X\x1b[2J")
+	assertive.IsEqual(t, screen.String(), "")
+
+	row, col := screen.Cursor()
+	assertive.IsEqual(t, row, 2)
+	assertive.IsEqual(t, col, 4)
+}
+
+func TestScreenInsertDelete(t *testing.T) {
+	t.Parallel()
+
+	screen := vt.New(3, 10)
+	screen.NewLineMode = true
+
+	write(screen, "abcdef\nsecond\nthird")
+
+	write(screen, "\x1b[1;2H\x1b[2P")
+	assertive.IsEqual(t, screen.Row(0), "adef")
+
+	write(screen, "\x1b[2@")
+	assertive.IsEqual(t, screen.Row(0), "a  def")
+
+	write(screen, "\x1b[2;1H\x1b[M")
+	assertive.IsEqual(t, screen.String(), "a  def\nthird")
+
+	write(screen, "\x1b[L")
+	assertive.IsEqual(t, screen.String(), "a  def\n\nthird")
+}
+
+func TestScreenScrollRegion(t *testing.T) {
+	t.Parallel()
+
+	screen := vt.New(4, 10)
+	screen.NewLineMode = true
+
+	write(screen, "header\none\ntwo\nfooter")
+
+	// Scrolling within rows 2 and 3 leaves the header and footer alone
+	write(screen, "\x1b[2;3r\x1b[3;1H\nthree")
+	assertive.IsEqual(t, screen.String(), "header\ntwo\nthree\nfooter")
+
+	// Reverse index at the top of the region scrolls down
+	write(screen, "\x1b[2;1H\x1bMzero")
+	assertive.IsEqual(t, screen.String(), "header\nzero\ntwo\nfooter")
+}
+
+func TestScreenAlternate(t *testing.T) {
+	t.Parallel()
+
+	screen := vt.New(3, 10)
+
+	write(screen, "main")
+	write(screen, "\x1b[?1049h\x1b[?25l\x1b[1;1Hfullscreen")
+	assertive.IsEqual(t, screen.String(), "fullscreen")
+	assertive.IsEqual(t, screen.CursorVisible(), false)
+
+	write(screen, "\x1b[?25h\x1b[?1049l")
+	assertive.IsEqual(t, screen.String(), "main")
+	assertive.IsEqual(t, screen.CursorVisible(), true)
+
+	row, col := screen.Cursor()
+	assertive.IsEqual(t, row, 0)
+	assertive.IsEqual(t, col, 4)
+}
+
+func TestScreenIgnoredSequences(t *testing.T) {
+	t.Parallel()
+
+	screen := vt.New(2, 20)
+
+	// Colors, a window title, a charset designation, and a private sequence
+	write(screen, "\x1b[1;31mred\x1b[0m\x1b]0;title\a\x1b(B\x1b[>c!")
+	assertive.IsEqual(t, screen.Row(0), "red!")
+}
+
+func TestScreenUnicodeSplit(t *testing.T) {
+	t.Parallel()
+
+	screen := vt.New(1, 10)
+	data := []byte("héllo ✓")
+
+	// Feed byte by byte, splitting multibyte characters across writes
+	for index := range data {
+		_, _ = screen.Write(data[index : index+1])
+	}
+
+	assertive.IsEqual(t, screen.Row(0), "héllo ✓")
+	assertive.IsEqual(t, screen.Cell(0, 6), '✓')
+}
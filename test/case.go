@@ -17,12 +17,17 @@
 package test
 
 import (
+	"os"
+	"path/filepath"
 	"slices"
+	"strings"
 	"testing"
 
 	"go.farcloser.world/tigron/internal/assertive"
 )
 
+const hermeticDirPerm = 0o700
+
 // Case describes an entire test-case, including data, setup and cleanup routines, command and
 // expectations.
 type Case struct {
@@ -36,6 +41,16 @@ type Case struct {
 	// Command and Cleanup
 	// Note that the environment is inherited by subtests
 	Env map[string]string
+	// KeepEnv, if not empty, lists the only variables from the host environment passed along to
+	// commands (for example PATH and HOME), on top of which Env is applied.
+	// Commands obtained with helpers.Custom are filtered as well.
+	// It is inherited by subtests, unless they define their own.
+	KeepEnv []string
+	// Hermetic, if true, points HOME and the XDG base directories to fresh directories inside the
+	// test temporary directory, and pins LANG, LC_ALL and TZ, so that commands neither see nor
+	// modify the configuration of the host. Variables explicitly set in Env are left alone.
+	// Subtests inherit the environment of their parent, including its hermetic directories.
+	Hermetic bool
 	// Data contains test specific data, accessible to all operations, also inherited by subtests
 	Data Data
 	// Config contains specific information meaningful to the binary being tested.
@@ -100,12 +115,22 @@ func (test *Case) Run(t *testing.T) {
 					test.Env[k] = v
 				}
 			}
+
+			if test.KeepEnv == nil {
+				test.KeepEnv = test.parent.KeepEnv
+			}
 		}
 
 		// Inherit and attach Data and Config
 		test.Data = configureData(test.t, test.Data, parentData)
 		test.Config = configureConfig(test.Config, parentConfig)
 
+		// Isolate from the host, if asked to
+		if test.Hermetic {
+			err := hermetic(test.Env, test.Data.TempDir())
+			assertive.ErrorIsNil(test.t, err, "Failed creating hermetic directories")
+		}
+
 		var custCom CustomizableCommand
 		if registeredTestable == nil {
 			custCom = NewGenericCommand()
@@ -117,6 +142,10 @@ func (test *Case) Run(t *testing.T) {
 		custCom.withT(test.t)
 		custCom.withTempDir(test.Data.TempDir())
 		custCom.withEnv(test.Env)
+
+		if len(test.KeepEnv) > 0 {
+			custCom.WithWhitelist(test.KeepEnv)
+		}
 		custCom.withConfig(test.Config)
 
 		// Attach the base command, and t
@@ -217,3 +246,37 @@ func (test *Case) Run(t *testing.T) {
 		testRun(t)
 	}
 }
+
+// hermetic adds to env an isolated HOME, XDG base directories, and deterministic locale and
+// timezone - except for variables that are already defined.
+func hermetic(env map[string]string, tempDir string) error {
+	home := filepath.Join(tempDir, "home")
+	hermeticEnv := map[string]string{
+		"HOME":            home,
+		"XDG_CONFIG_HOME": filepath.Join(home, ".config"),
+		"XDG_DATA_HOME":   filepath.Join(home, ".local", "share"),
+		"XDG_STATE_HOME":  filepath.Join(home, ".local", "state"),
+		"XDG_CACHE_HOME":  filepath.Join(home, ".cache"),
+		"XDG_RUNTIME_DIR": filepath.Join(tempDir, "run"),
+		"LANG":            "C.UTF-8",
+		"LC_ALL":          "C.UTF-8",
+		"TZ":              "UTC",
+	}
+
+	for key, value := range hermeticEnv {
+		if _, ok := env[key]; ok {
+			continue
+		}
+
+		if key == "HOME" || strings.HasPrefix(key, "XDG_") {
+			if err := os.MkdirAll(value, hermeticDirPerm); err != nil {
+				//nolint:wrapcheck
+				return err
+			}
+		}
+
+		env[key] = value
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+package test_test
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.farcloser.world/tigron/internal/assertive"
+	"go.farcloser.world/tigron/test"
+)
+
+const windows = "windows"
+
+// environ parses the output of `env` into a map.
+func environ(stdout string) map[string]string {
+	env := map[string]string{}
+
+	for _, line := range strings.Split(strings.TrimSpace(stdout), "\n") {
+		key, value, _ := strings.Cut(line, "=")
+		env[key] = value
+	}
+
+	return env
+}
+
+//nolint:paralleltest // Case.Run takes care of it
+func TestKeepEnv(t *testing.T) {
+	//nolint:thelper
+	kept := func(stdout, info string, t *testing.T) {
+		t.Helper()
+
+		env := environ(stdout)
+
+		assertive.IsEqual(t, env["TIGRON_KEEPENV"], "set", info)
+		assertive.True(t, env["PATH"] != "", "PATH should have been kept", info)
+
+		// On windows, with mingw, SYSTEMROOT, TERM and HOME (possibly others) will be forcefully
+		// added to the environment regardless
+		if runtime.GOOS != windows {
+			for key := range env {
+				assertive.True(t, slices.Contains([]string{"PATH", "TIGRON_KEEPENV"}, key),
+					key+" should not have been passed along", info)
+			}
+		}
+	}
+
+	testCase := &test.Case{
+		KeepEnv: []string{"PATH"},
+		Env: map[string]string{
+			"TIGRON_KEEPENV": "set",
+		},
+		// Bare commands are filtered as well
+		Command: func(_ test.Data, helpers test.Helpers) test.TestableCommand {
+			return helpers.Custom("env")
+		},
+		Expected: test.Expects(0, nil, kept),
+		SubTests: []*test.Case{
+			{
+				Description: "inherited by subtests",
+				Command: func(_ test.Data, helpers test.Helpers) test.TestableCommand {
+					return helpers.Custom("env")
+				},
+				Expected: test.Expects(0, nil, kept),
+			},
+		},
+	}
+
+	testCase.Run(t)
+}
+
+//nolint:paralleltest // Case.Run takes care of it
+func TestHermetic(t *testing.T) {
+	testCase := &test.Case{
+		Hermetic: true,
+		Env: map[string]string{
+			"TZ": "Europe/Paris",
+		},
+		Command: func(_ test.Data, helpers test.Helpers) test.TestableCommand {
+			return helpers.Custom("env")
+		},
+		Expected: func(data test.Data, _ test.Helpers) *test.Expected {
+			return &test.Expected{
+				//nolint:thelper
+				Output: func(stdout, info string, t *testing.T) {
+					t.Helper()
+
+					env := environ(stdout)
+
+					// Explicit values win
+					assertive.IsEqual(t, env["TZ"], "Europe/Paris", info)
+					assertive.IsEqual(t, env["LANG"], "C.UTF-8", info)
+					assertive.IsEqual(t, env["LC_ALL"], "C.UTF-8", info)
+
+					// mingw rewrites paths in the environment of the command
+					if runtime.GOOS == windows {
+						return
+					}
+
+					home := filepath.Join(data.TempDir(), "home")
+					directories := map[string]string{
+						"HOME":            home,
+						"XDG_CONFIG_HOME": filepath.Join(home, ".config"),
+						"XDG_DATA_HOME":   filepath.Join(home, ".local", "share"),
+						"XDG_STATE_HOME":  filepath.Join(home, ".local", "state"),
+						"XDG_CACHE_HOME":  filepath.Join(home, ".cache"),
+						"XDG_RUNTIME_DIR": filepath.Join(data.TempDir(), "run"),
+					}
+
+					for key, directory := range directories {
+						assertive.IsEqual(t, env[key], directory, info)
+
+						stat, err := os.Stat(directory)
+						assertive.ErrorIsNil(t, err, key+" should have been created", info)
+						assertive.True(t, stat.IsDir(), key+" should be a directory", info)
+					}
+				},
+			}
+		},
+	}
+
+	testCase.Run(t)
+}
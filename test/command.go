@@ -19,9 +19,11 @@ package test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -44,6 +46,15 @@ type CustomizableCommand interface {
 	// WithBlacklist allows to filter out unwanted variables from the embedding environment -
 	// default it pass any that is defined by WithEnv
 	WithBlacklist(env []string)
+	// WithWhitelist restricts the variables passed along from the embedding environment to the
+	// ones listed (still subject to the blacklist). Variables defined by WithEnv are not affected.
+	WithWhitelist(env []string)
+	// WithBlacklistPatterns and WithWhitelistPatterns are similar to WithBlacklist and
+	// WithWhitelist, with regular expressions matched against variable names.
+	WithBlacklistPatterns(patterns []*regexp.Regexp)
+	WithWhitelistPatterns(patterns []*regexp.Regexp)
+	// WithUnsetEnv ensures the listed variables are not set at all, even if defined by WithEnv.
+	WithUnsetEnv(env []string)
 	// T returns the current testing object
 	T() *testing.T
 
@@ -89,8 +100,15 @@ type GenericCommand struct {
 
 	t *testing.T
 
-	cmd   *com.Command
-	async bool
+	cmd     *com.Command
+	async   bool
+	waited  bool
+	orphans OrphanPolicy
+
+	readiness        []ReadinessProbe
+	readinessTimeout time.Duration
+	//nolint:containedctx // The context is only passed along to the command when it is run
+	ctx context.Context
 
 	rawStdErr string
 }
@@ -112,6 +130,23 @@ func (gc *GenericCommand) WithPseudoTTY() {
 	gc.cmd.WithPTY(true, true, false)
 }
 
+func (gc *GenericCommand) WithPTY(stdin, stdout, stderr bool) {
+	gc.cmd.WithPTY(stdin, stdout, stderr)
+
+	if stderr {
+		gc.cmd.WithSeparateStderrPTY()
+	}
+}
+
+func (gc *GenericCommand) WithTerminalSize(rows, cols uint16) {
+	gc.cmd.WithPTYSize(rows, cols)
+}
+
+func (gc *GenericCommand) Resize(rows, cols uint16) error {
+	//nolint:wrapcheck
+	return gc.cmd.Resize(rows, cols)
+}
+
 func (gc *GenericCommand) Feed(r io.Reader) {
 	gc.cmd.Feed(r)
 }
@@ -120,6 +155,34 @@ func (gc *GenericCommand) WithFeeder(fun func() io.Reader) {
 	gc.cmd.WithFeeder(fun)
 }
 
+func (gc *GenericCommand) WithDialog(steps ...*DialogStep) {
+	for _, step := range steps {
+		gc.cmd.WithDialog(&com.DialogStep{
+			Expect:  step.Expect,
+			Send:    step.Send,
+			Timeout: step.Timeout,
+			Delay:   step.Delay,
+			Close:   step.Close,
+		})
+	}
+}
+
+func (gc *GenericCommand) WithOpenStdin() {
+	gc.cmd.WithOpenStdin()
+}
+
+func (gc *GenericCommand) WithStdoutObserver(fun func(line string)) {
+	gc.cmd.WithObserver(com.Stdout, func() io.Writer {
+		return com.NewLineWriter(fun)
+	})
+}
+
+func (gc *GenericCommand) WithStderrObserver(fun func(line string)) {
+	gc.cmd.WithObserver(com.Stderr, func() io.Writer {
+		return com.NewLineWriter(fun)
+	})
+}
+
 func (gc *GenericCommand) WithCwd(path string) {
 	gc.cmd.WorkingDir = path
 }
@@ -128,18 +191,156 @@ func (gc *GenericCommand) WithBlacklist(env []string) {
 	gc.cmd.EnvBlackList = env
 }
 
+func (gc *GenericCommand) WithWhitelist(env []string) {
+	gc.cmd.EnvWhiteList = env
+}
+
+func (gc *GenericCommand) WithBlacklistPatterns(patterns []*regexp.Regexp) {
+	gc.cmd.EnvBlackListPatterns = patterns
+}
+
+func (gc *GenericCommand) WithWhitelistPatterns(patterns []*regexp.Regexp) {
+	gc.cmd.EnvWhiteListPatterns = patterns
+}
+
+func (gc *GenericCommand) WithUnsetEnv(env []string) {
+	gc.cmd.EnvUnset = env
+}
+
 func (gc *GenericCommand) WithTimeout(timeout time.Duration) {
 	gc.cmd.Timeout = timeout
 }
 
+func (gc *GenericCommand) WithTimeoutEscalation(grace time.Duration, signals ...os.Signal) {
+	gc.cmd.TimeoutEscalation = nil
+
+	for _, sig := range signals {
+		gc.cmd.TimeoutEscalation = append(gc.cmd.TimeoutEscalation, &com.Escalation{
+			Signal: sig,
+			Grace:  grace,
+		})
+	}
+}
+
+func (gc *GenericCommand) WithOrphanPolicy(policy OrphanPolicy) {
+	gc.orphans = policy
+	gc.cmd.KillOrphans = policy != OrphanReport
+}
+
+func (gc *GenericCommand) WithSandbox() {
+	gc.cmd.Sandbox = true
+
+	if gc.TempDir != "" {
+		gc.cmd.SandboxPaths = []string{gc.TempDir}
+	}
+}
+
+func (gc *GenericCommand) WithLimits(limits Limits) {
+	gc.cmd.Limits = &com.Limits{
+		OpenFiles:    limits.OpenFiles,
+		AddressSpace: limits.AddressSpace,
+		CPUTime:      limits.CPUTime,
+		CoreSize:     limits.CoreSize,
+		Processes:    limits.Processes,
+	}
+}
+
+func (gc *GenericCommand) WithOutputLimit(size int64) {
+	gc.cmd.MaxOutputSize = size
+}
+
 func (gc *GenericCommand) PrependArgs(args ...string) {
 	gc.cmd.PrependArgs = args
 }
 
+func (gc *GenericCommand) WithReadiness(timeout time.Duration, probes ...ReadinessProbe) {
+	gc.readinessTimeout = timeout
+	gc.readiness = append(gc.readiness, probes...)
+}
+
 func (gc *GenericCommand) Background() {
+	if gc.t != nil {
+		gc.t.Helper()
+	}
+
 	gc.async = true
 
-	_ = gc.cmd.Run(context.Background())
+	var live *liveOutput
+
+	if len(gc.readiness) > 0 {
+		live = &liveOutput{limit: gc.cmd.MaxOutputSize}
+		gc.cmd.WithObserver(com.Stdout, live.provider)
+		gc.cmd.WithObserver(com.Stderr, live.provider)
+	}
+
+	_ = gc.cmd.Run(gc.context())
+
+	// Ensure the command does not outlive the test
+	if gc.t != nil {
+		gc.t.Cleanup(gc.reap)
+	}
+
+	if live == nil {
+		return
+	}
+
+	timeout := gc.readinessTimeout
+	if timeout <= 0 {
+		timeout = defaultReadinessTimeout
+	}
+
+	if !awaitReadiness(gc.cmd, live, gc.readiness, timeout) {
+		message := fmt.Sprintf("Command did not become ready within %s\n", timeout)
+
+		select {
+		case <-gc.cmd.Exited():
+			message = "Command exited before becoming ready\n"
+		default:
+		}
+
+		// Terminate it to get the full picture
+		gc.cmd.Cancel()
+
+		result, err := gc.cmd.Wait()
+		gc.waited = true
+
+		if result == nil {
+			assertive.ErrorIsNil(gc.t, err, "Command failed starting")
+		}
+
+		assertive.True(gc.t, false, message, gc.debug(result, ""))
+	}
+}
+
+// reap terminates and waits for a backgrounded command that the test did not Run, and logs its
+// outcome if the test failed.
+func (gc *GenericCommand) reap() {
+	if gc.waited {
+		return
+	}
+
+	gc.cmd.Cancel()
+
+	result, err := gc.cmd.Wait()
+	if errors.Is(err, com.ErrExecAlreadyFinished) || result == nil {
+		return
+	}
+
+	if gc.t.Failed() {
+		gc.t.Log(gc.debug(result, "Backgrounded command, terminated on test cleanup"))
+	}
+}
+
+func (gc *GenericCommand) WithContext(ctx context.Context) {
+	gc.ctx = ctx
+}
+
+func (gc *GenericCommand) context() context.Context {
+	if gc.ctx == nil {
+		return context.Background()
+	}
+
+	return gc.ctx
 }
 
 func (gc *GenericCommand) Signal(sig os.Signal) error {
@@ -147,97 +348,306 @@ func (gc *GenericCommand) Signal(sig os.Signal) error {
 	return gc.cmd.Signal(sig)
 }
 
+func (gc *GenericCommand) Write(data []byte) (int, error) {
+	//nolint:wrapcheck
+	return gc.cmd.Write(data)
+}
+
+func (gc *GenericCommand) CloseStdin() error {
+	//nolint:wrapcheck
+	return gc.cmd.CloseStdin()
+}
+
 func (gc *GenericCommand) Run(expect *Expected) {
 	if gc.t != nil {
 		gc.t.Helper()
 	}
 
+	result, err := gc.execute()
+
+	// Check our expectations, if any
+	if expect != nil {
+		gc.verify(gc.t, expect, result, err, "")
+	}
+}
+
+func (gc *GenericCommand) RunEventually(
+	until func(stdout string) bool,
+	expect *Expected,
+	interval, deadline time.Duration,
+) {
+	if gc.t != nil {
+		gc.t.Helper()
+	}
+
+	limit := time.Now().Add(deadline)
+
+	for attempts := 1; ; attempts++ {
+		//nolint:forcetypeassert // Clone always returns a GenericCommand
+		attempt := gc.Clone().(*GenericCommand)
+		result, err := attempt.execute()
+		gc.rawStdErr = attempt.rawStdErr
+
+		met := until(result.Stdout)
+
+		if met || time.Now().Add(interval).After(limit) {
+			// Verify the last attempt only
+			note := fmt.Sprintf("Attempts: %d (every %s, for %s)", attempts, interval, deadline)
+
+			assertive.True(gc.t, met, "Condition was never met", gc.debug(result, note))
+
+			if expect != nil {
+				attempt.verify(gc.t, expect, result, err, note)
+			}
+
+			return
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// withStdio connects the command stdin and / or stdout to the provided files (if not nil).
+func (gc *GenericCommand) withStdio(stdin, stdout *os.File) {
+	if stdin != nil {
+		gc.cmd.WithStdin(stdin)
+	}
+
+	if stdout != nil {
+		gc.cmd.WithStdout(stdout)
+	}
+}
+
+func (gc *GenericCommand) commandLine() string {
+	return gc.cmd.Binary + " " + strings.Join(gc.cmd.Args, " ")
+}
+
+// execute runs the command (unless it was backgrounded) and waits for it.
+func (gc *GenericCommand) execute() (*com.Result, error) {
 	if !gc.async {
-		_ = gc.cmd.Run(context.Background())
+		_ = gc.cmd.Run(gc.context())
 	}
 
 	result, err := gc.cmd.Wait()
+	gc.waited = true
+
 	if result != nil {
 		gc.rawStdErr = result.Stderr
 	}
 
-	// Check our expectations, if any
-	if expect != nil {
-		// Build the debug string
-		separator := "================================="
-		debugCommand := gc.cmd.Binary + " " + strings.Join(gc.cmd.Args, " ")
-		debugTimeout := gc.cmd.Timeout
-		debugWD := gc.cmd.WorkingDir
-
-		// FIXME: this is ugly af. Do better.
-		debug := fmt.Sprintf(
-			"\n%s\n| Command:\t%s\n| Working Dir:\t%s\n| Timeout:\t%s\n%s\n"+
-				"%s\n%s\n| Stderr:\n%s\n%s\n%s\n| Stdout:\n%s\n%s\n%s\n| Exit Code: %d\n%s",
-			separator,
-			debugCommand,
-			debugWD,
-			debugTimeout,
-			separator,
-			"\t"+strings.Join(result.Environ, "\n\t"),
-			separator,
-			separator,
-			result.Stderr,
-			separator,
-			separator,
-			result.Stdout,
-			separator,
-			result.ExitCode,
-			separator,
+	//nolint:wrapcheck
+	return result, err
+}
+
+// verify checks the outcome of the command against expectations, failing t if they are not met.
+func (gc *GenericCommand) verify(t *testing.T, expect *Expected, result *com.Result, err error, note string) {
+	if t != nil {
+		t.Helper()
+	}
+
+	debug := gc.debug(result, note)
+
+	// A failed dialog means the command did not behave as scripted, regardless of exit code
+	if errors.Is(err, com.ErrDialogFailed) {
+		assertive.ErrorIsNil(t, err, "Dialog with the command failed", debug)
+	}
+
+	// ExitCode goes first
+	switch expect.ExitCode {
+	case internal.ExitCodeNoCheck:
+		// ExitCodeNoCheck means we do not care at all about what happened. Fire and forget...
+	case internal.ExitCodeGenericFail:
+		// ExitCodeGenericFail means we expect an error (excluding timeout, cancellation,
+		// signalling).
+		assertive.ErrorIs(
+			t,
+			err,
+			com.ErrExecutionFailed,
+			"Command should have failed",
+			debug,
+		)
+	case internal.ExitCodeTimeout:
+		assertive.ErrorIs(
+			t,
+			err,
+			com.ErrTimeout,
+			"Command should have timed out",
+			debug,
+		)
+	case internal.ExitCodeSignaled:
+		assertive.ErrorIs(
+			t,
+			err,
+			com.ErrSignaled,
+			"Command should have been signaled",
+			debug,
 		)
+	case internal.ExitCodeCancelled:
+		assertive.ErrorIs(
+			t,
+			err,
+			com.ErrCancelled,
+			"Command should have been cancelled",
+			debug,
+		)
+	case internal.ExitCodeSuccess:
+		assertive.ErrorIsNil(t, err, "Command should have succeeded", debug)
+	default:
+		assertive.IsEqual(t, expect.ExitCode, result.ExitCode,
+			fmt.Sprintf("Expected exit code: %d\n", expect.ExitCode), debug)
+	}
 
-		// ExitCode goes first
-		switch expect.ExitCode {
-		case internal.ExitCodeNoCheck:
-			// ExitCodeNoCheck means we do not care at all about what happened. Fire and forget...
-		case internal.ExitCodeGenericFail:
-			// ExitCodeGenericFail means we expect an error (excluding timeout, cancellation,
-			// signalling).
-			assertive.ErrorIs(
-				gc.t,
-				err,
-				com.ErrExecutionFailed,
-				"Command should have failed",
-				debug,
-			)
-		case internal.ExitCodeTimeout:
-			assertive.ErrorIs(
-				gc.t,
-				err,
-				com.ErrTimeout,
-				"Command should have timed out",
-				debug,
-			)
-		case internal.ExitCodeSignaled:
-			assertive.ErrorIs(
-				gc.t,
-				err,
-				com.ErrSignaled,
-				"Command should have been signaled",
-				debug,
-			)
-		case internal.ExitCodeSuccess:
-			assertive.ErrorIsNil(gc.t, err, "Command should have succeeded", debug)
-		default:
-			assertive.IsEqual(gc.t, expect.ExitCode, result.ExitCode,
-				fmt.Sprintf("Expected exit code: %d\n", expect.ExitCode), debug)
-		}
+	if expect.Signal != nil {
+		assertive.IsEqual(t, result.Signal, expect.Signal,
+			fmt.Sprintf("Expected command to be terminated by %s\n", expect.Signal), debug)
+	}
 
-		// Range through the expected errors and confirm they are seen on stderr
-		for _, expectErr := range expect.Errors {
-			assertive.StringContains(gc.t, result.Stderr, expectErr.Error(),
-				fmt.Sprintf("Expected error: %q to be found in stderr\n", expectErr.Error()), debug)
-		}
+	// Then resource usage
+	gc.checkUsage(t, result, expect, debug)
+
+	if gc.orphans == OrphanFail {
+		assertive.True(t, len(result.Orphans) == 0, "Command should not leave processes behind", debug)
+	}
+
+	// Range through the expected errors and confirm they are seen on stderr
+	for _, expectErr := range expect.Errors {
+		assertive.StringContains(t, result.Stderr, expectErr.Error(),
+			fmt.Sprintf("Expected error: %q to be found in stderr\n", expectErr.Error()), debug)
+	}
+
+	// Finally, check the output if we are asked to
+	if expect.Output != nil {
+		expect.Output(result.Stdout, debug, t)
+	}
+
+	if expect.OutputStream != nil {
+		gc.compareStream(t, result, expect.OutputStream, debug)
+	}
+}
+
+// debug builds the information displayed along failed expectations.
+func (gc *GenericCommand) debug(result *com.Result, note string) string {
+	separator := "================================="
+	debugCommand := gc.commandLine()
+	debugTimeout := gc.cmd.Timeout
+	debugWD := gc.cmd.WorkingDir
 
-		// Finally, check the output if we are asked to
-		if expect.Output != nil {
-			expect.Output(result.Stdout, debug, gc.t)
+	debugStdout := "Stdout:"
+	if result.StdoutSpill != "" {
+		debugStdout = "Stdout (truncated, full output in " + result.StdoutSpill + "):"
+	}
+
+	debugStderr := "Stderr:"
+	if result.StderrSpill != "" {
+		debugStderr = "Stderr (truncated, full output in " + result.StderrSpill + "):"
+	}
+
+	debugExit := fmt.Sprintf("Exit Code: %d", result.ExitCode)
+	if result.CancelSignal != nil {
+		debugExit += fmt.Sprintf(" (terminated by %s after timeout or cancellation)", result.CancelSignal)
+	}
+
+	debugExit += fmt.Sprintf(
+		"\n| Duration: %s (user: %s, system: %s, max rss: %d bytes)",
+		result.Duration,
+		result.UserTime,
+		result.SystemTime,
+		result.MaxRSS,
+	)
+
+	if result.Signal != nil {
+		debugExit += fmt.Sprintf("\n| Signal: %s", result.Signal)
+	}
+
+	if len(result.Orphans) > 0 {
+		debugExit += "\n| Processes left behind:"
+		for _, orphan := range result.Orphans {
+			debugExit += fmt.Sprintf("\n|\t%d\t%s", orphan.PID, orphan.Command)
 		}
 	}
+
+	if note != "" {
+		debugExit += "\n| " + note
+	}
+
+	// The transcript interleaves stdout and stderr: only show it if there is something to interleave
+	debugTranscript := ""
+	if result.Stdout != "" && result.Stderr != "" {
+		debugTranscript = "| Transcript:\n" + separator + "\n" + result.Transcript.String() + separator + "\n"
+	}
+
+	// FIXME: this is ugly af. Do better.
+	return fmt.Sprintf(
+		"\n%s\n| Command:\t%s\n| Working Dir:\t%s\n| Timeout:\t%s\n%s\n"+
+			"%s\n%s\n| %s\n%s\n%s\n%s\n| %s\n%s\n%s\n%s\n%s"+
+			"| %s\n%s",
+		separator,
+		debugCommand,
+		debugWD,
+		debugTimeout,
+		separator,
+		"\t"+strings.Join(result.Environ, "\n\t"),
+		separator,
+		debugStderr,
+		separator,
+		result.Stderr,
+		separator,
+		debugStdout,
+		separator,
+		result.Stdout,
+		separator,
+		debugTranscript,
+		debugExit,
+		separator,
+	)
+}
+
+func (gc *GenericCommand) checkUsage(t *testing.T, result *com.Result, expect *Expected, debug string) {
+	if t != nil {
+		t.Helper()
+	}
+
+	if expect.MaxDuration > 0 {
+		assertive.DurationIsLessThan(t, result.Duration, expect.MaxDuration,
+			fmt.Sprintf("Expected command to complete within %s\n", expect.MaxDuration), debug)
+	}
+
+	if expect.MaxCPUTime > 0 {
+		assertive.DurationIsLessThan(t, result.UserTime+result.SystemTime, expect.MaxCPUTime,
+			fmt.Sprintf("Expected command to use less than %s of CPU\n", expect.MaxCPUTime), debug)
+	}
+
+	if expect.MaxMemory > 0 && result.MaxRSS > 0 {
+		assertive.True(t, result.MaxRSS < expect.MaxMemory,
+			fmt.Sprintf("Expected command peak memory (%d bytes) to be less than %d bytes\n",
+				result.MaxRSS, expect.MaxMemory), debug)
+	}
+}
+
+func (gc *GenericCommand) compareStream(
+	t *testing.T,
+	result *com.Result,
+	comparator StreamComparator,
+	debug string,
+) {
+	if t != nil {
+		t.Helper()
+	}
+
+	if result.StdoutSpill == "" {
+		comparator(strings.NewReader(result.Stdout), debug, t)
+
+		return
+	}
+
+	file, err := os.Open(result.StdoutSpill)
+	assertive.ErrorIsNil(t, err, "Failed opening stdout spill file", debug)
+
+	defer func() {
+		_ = file.Close()
+	}()
+
+	comparator(file, debug, t)
 }
 
 func (gc *GenericCommand) Stderr() string {
@@ -252,6 +662,7 @@ func (gc *GenericCommand) withEnv(env map[string]string) {
 
 func (gc *GenericCommand) withTempDir(path string) {
 	gc.TempDir = path
+	gc.cmd.SpillDir = path
 }
 
 func (gc *GenericCommand) withConfig(config Config) {
@@ -263,6 +674,7 @@ func (gc *GenericCommand) Clone() TestableCommand {
 	clone := *gc
 	clone.rawStdErr = ""
 	clone.async = false
+	clone.waited = false
 
 	// Clone Env
 	clone.Env = make(map[string]string, len(gc.Env))
@@ -284,9 +696,22 @@ func (gc *GenericCommand) T() *testing.T {
 func (gc *GenericCommand) clear() TestableCommand {
 	comcopy := *gc
 	// Reset internal command
-	comcopy.cmd = &com.Command{}
+	comcopy.cmd = &com.Command{
+		SpillDir: gc.TempDir,
+		// Retain environment filtering
+		EnvBlackList:         gc.cmd.EnvBlackList,
+		EnvWhiteList:         gc.cmd.EnvWhiteList,
+		EnvBlackListPatterns: gc.cmd.EnvBlackListPatterns,
+		EnvWhiteListPatterns: gc.cmd.EnvWhiteListPatterns,
+		EnvUnset:             gc.cmd.EnvUnset,
+	}
 	comcopy.rawStdErr = ""
 	comcopy.async = false
+	comcopy.waited = false
+	comcopy.orphans = OrphanReport
+	comcopy.ctx = nil
+	comcopy.readiness = nil
+	comcopy.readinessTimeout = 0
 	// Clone Env
 	comcopy.Env = make(map[string]string, len(gc.Env))
 	// Reset configuration
@@ -0,0 +1,143 @@
+//go:build !windows
+
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+package test_test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.farcloser.world/tigron/expect"
+	"go.farcloser.world/tigron/internal/assertive"
+	"go.farcloser.world/tigron/test"
+)
+
+//nolint:paralleltest // Case.Run takes care of it
+func TestWithLimits(t *testing.T) {
+	testCase := &test.Case{
+		SubTests: []*test.Case{
+			{
+				Description: "hard limits",
+				Command: func(_ test.Data, helpers test.Helpers) test.TestableCommand {
+					cmd := helpers.Custom("sh", "-c", "ulimit -Sn; ulimit -Hn")
+					cmd.WithLimits(test.Limits{OpenFiles: 64})
+
+					return cmd
+				},
+				Expected: test.Expects(expect.ExitCodeSuccess, nil, expect.Equals("64\n64\n")),
+			},
+			{
+				Description: "cpu time",
+				Command: func(_ test.Data, helpers test.Helpers) test.TestableCommand {
+					cmd := helpers.Custom("sh", "-c", "while :; do :; done")
+					cmd.WithLimits(test.Limits{CPUTime: time.Second})
+					cmd.WithTimeout(10 * time.Second)
+
+					return cmd
+				},
+				Expected: func(_ test.Data, _ test.Helpers) *test.Expected {
+					return &test.Expected{
+						ExitCode: expect.ExitCodeSignaled,
+						Signal:   syscall.SIGXCPU,
+					}
+				},
+			},
+		},
+	}
+
+	testCase.Run(t)
+}
+
+//nolint:paralleltest // Case.Run takes care of it
+func TestBackgroundReaped(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+
+	// Registered first, so this runs after the cleanups of the case
+	t.Cleanup(func() {
+		content, err := os.ReadFile(pidFile)
+		assertive.ErrorIsNil(t, err, "The backgrounded command should have written its pid")
+
+		pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+		assertive.ErrorIsNil(t, err)
+
+		assertive.ErrorIs(t, syscall.Kill(pid, 0), syscall.ESRCH,
+			"The backgrounded command should not outlive the test")
+	})
+
+	testCase := &test.Case{
+		Setup: func(_ test.Data, helpers test.Helpers) {
+			cmd := helpers.Custom("sh", "-c", "echo $$ > "+pidFile+".tmp && mv "+pidFile+".tmp "+pidFile+
+				" && exec sleep 100")
+			cmd.WithReadiness(10*time.Second, test.ReadyOnFile(pidFile))
+			cmd.Background()
+		},
+		Command: func(_ test.Data, helpers test.Helpers) test.TestableCommand {
+			return helpers.Custom("true")
+		},
+		Expected: test.Expects(expect.ExitCodeSuccess, nil, nil),
+	}
+
+	testCase.Run(t)
+}
+
+//nolint:paralleltest // Case.Run takes care of it
+func TestBackgroundReapedLogs(t *testing.T) {
+	testCase := &test.Case{
+		Env: map[string]string{
+			"TIGRON_FAILING_BACKGROUND": "1",
+		},
+		// Run a test that fails with a command still in the background, and see what it logs
+		Command: func(_ test.Data, helpers test.Helpers) test.TestableCommand {
+			return helpers.Custom(os.Args[0], "-test.run=^TestFailingBackground$", "-test.count=1")
+		},
+		Expected: test.Expects(expect.ExitCodeGenericFail, nil, expect.All(
+			expect.Contains("Backgrounded command, terminated on test cleanup"),
+			expect.Contains("still running"),
+		)),
+	}
+
+	testCase.Run(t)
+}
+
+// TestFailingBackground is only run by TestBackgroundReapedLogs.
+//
+//nolint:paralleltest // Case.Run takes care of it
+func TestFailingBackground(t *testing.T) {
+	if os.Getenv("TIGRON_FAILING_BACKGROUND") == "" {
+		t.Skip("only run by TestBackgroundReapedLogs")
+	}
+
+	testCase := &test.Case{
+		Setup: func(_ test.Data, helpers test.Helpers) {
+			cmd := helpers.Custom("sh", "-c", "echo still running; exec sleep 100")
+			cmd.WithReadiness(10*time.Second, test.ReadyOnOutput(regexp.MustCompile("running")))
+			cmd.Background()
+
+			helpers.T().Error("failing on purpose")
+		},
+	}
+
+	testCase.Run(t)
+}
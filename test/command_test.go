@@ -0,0 +1,73 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+package test_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.farcloser.world/tigron/expect"
+	"go.farcloser.world/tigron/test"
+)
+
+//nolint:paralleltest // Case.Run takes care of it
+func TestRunEventually(t *testing.T) {
+	testCase := &test.Case{
+		Setup: func(data test.Data, helpers test.Helpers) {
+			// Every attempt appends a line, and the third one meets the condition
+			cmd := helpers.Custom("sh", "-c", "echo . >> attempts; wc -l < attempts")
+			cmd.WithCwd(data.TempDir())
+			cmd.RunEventually(func(stdout string) bool {
+				return strings.TrimSpace(stdout) == "3"
+			}, &test.Expected{
+				Output: expect.Contains("3"),
+			}, 10*time.Millisecond, 10*time.Second)
+		},
+		Command: func(data test.Data, helpers test.Helpers) test.TestableCommand {
+			return helpers.Custom("cat", filepath.Join(data.TempDir(), "attempts"))
+		},
+		// No further attempt should have been made once the condition was met
+		Expected: test.Expects(0, nil, expect.Equals(".\n.\n.\n")),
+	}
+
+	testCase.Run(t)
+}
+
+//nolint:paralleltest // Case.Run takes care of it
+func TestBackgroundCancelled(t *testing.T) {
+	testCase := &test.Case{
+		Command: func(_ test.Data, helpers test.Helpers) test.TestableCommand {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			cmd := helpers.Custom("sleep", "10")
+			cmd.WithContext(ctx)
+			cmd.Background()
+
+			// Cancelling the context terminates the backgrounded command before Case.Run waits for it
+			cancel()
+
+			return cmd
+		},
+		Expected: test.Expects(expect.ExitCodeCancelled, nil, nil),
+	}
+
+	testCase.Run(t)
+}
@@ -16,7 +16,10 @@
 
 package test
 
-import "testing"
+import (
+	"io"
+	"testing"
+)
 
 // An Evaluator is a function that decides whether a test should run or not.
 type Evaluator func(data Data, helpers Helpers) (bool, string)
@@ -28,6 +31,11 @@ type Butler func(data Data, helpers Helpers)
 // A Comparator is the function signature to implement for the Output property of an Expected.
 type Comparator func(stdout, info string, t *testing.T)
 
+// A StreamComparator is the function signature to implement for the OutputStream property of an
+// Expected. It reads stdout in full, as raw bytes (making it suitable for binary output), even if
+// it was too large to be held in memory.
+type StreamComparator func(stdout io.Reader, info string, t *testing.T)
+
 // A Manager is the function signature meant to produce expectations for a command.
 type Manager func(data Data, helpers Helpers) *Expected
 
@@ -17,6 +17,7 @@
 package test
 
 import (
+	"context"
 	"io"
 	"os"
 	"testing"
@@ -59,7 +60,8 @@ type Helpers interface {
 	// Command will return a populated command from the default internal command, with the provided
 	// arguments, ready to be Run or further configured.
 	Command(args ...string) TestableCommand
-	// Custom will return a bare command, without configuration nor defaults (still has the Env).
+	// Custom will return a bare command, without configuration nor defaults (still has the Env, and
+	// the environment filtering, eg: KeepEnv).
 	Custom(binary string, args ...string) TestableCommand
 
 	// Read return the config value associated with a key.
@@ -84,15 +86,62 @@ type TestableCommand interface {
 	// WithWrapper allows wrapping a command with another command (for example: `time`).
 	WithWrapper(binary string, args ...string)
 	// WithPseudoTTY will allocate a new pty and set the command stdin and stdout to it.
+	// Stderr remains a pipe.
 	WithPseudoTTY()
+	// WithPTY allows choosing which of stdin, stdout and stderr are tied to a pty.
+	// If stderr is tied to a pty, it gets a separate one, so that it can still be captured
+	// independently of stdout.
+	WithPTY(stdin, stdout, stderr bool)
+	// WithTerminalSize sets the size of the pty (if any) the command starts with.
+	WithTerminalSize(rows, cols uint16)
+	// Resize changes the size of the pty of a backgrounded command, which gets notified with
+	// SIGWINCH.
+	Resize(rows, cols uint16) error
 	// WithCwd allows specifying the working directory for the command.
 	WithCwd(path string)
 	// WithTimeout defines the execution timeout for a command.
 	WithTimeout(timeout time.Duration)
+	// WithTimeoutEscalation defines the signals sent to the command process group if it times out,
+	// each of them leaving it grace to exit, before it gets killed (default is to kill right away).
+	// This allows commands to clean up after themselves on SIGTERM, for example.
+	WithTimeoutEscalation(grace time.Duration, signals ...os.Signal)
+	// WithOrphanPolicy decides what to do with processes the command leaves behind once it exits
+	// (linux only). By default, they are only reported in the debug output.
+	WithOrphanPolicy(policy OrphanPolicy)
+	// WithSandbox runs the command in new user, mount, pid, network and uts namespaces (linux
+	// only, and provided the kernel allows unprivileged user namespaces), as root. The command then
+	// only sees the loopback interface, its own processes, and a private /tmp (where the test
+	// temporary directory remains reachable). Commands killed by a signal in a sandbox report an
+	// exit code of 128 + the signal number.
+	WithSandbox()
+	// WithLimits applies resource limits (rlimits) to the command (not supported on windows), to
+	// verify its behavior when running out of file descriptors, memory, etc. A command exceeding
+	// its CPU time gets SIGXCPU, which can be verified with Expected.Signal.
+	WithLimits(limits Limits)
+	// WithOutputLimit caps how many bytes of stdout (and stderr) are held in memory. Past that,
+	// the full output is written to a file in the test temporary directory, and remains available
+	// to Expected.OutputStream.
+	WithOutputLimit(size int64)
 	// Feed allows passing a reader to be fed to the command stdin.
 	Feed(r io.Reader)
 	// WithFeeder allows passing a reader to be fed to the command stdin.
 	WithFeeder(fun func() io.Reader)
+	// WithDialog scripts a conversation with the command: each step waits for its expected output,
+	// then sends its response on stdin. Failure to see the expected output in time will fail the
+	// test, reporting the failing step and the output at that point. This is typically used along
+	// with WithPseudoTTY, to answer interactive prompts.
+	// Steps may also wait for a Delay before sending, and Close stdin, to script the input of
+	// commands reading it incrementally.
+	WithDialog(steps ...*DialogStep)
+	// WithOpenStdin keeps stdin open once everything has been fed, instead of closing it, unless a
+	// dialog step closes it explicitly.
+	WithOpenStdin()
+	// WithStdoutObserver registers a function that will be called with every line the command
+	// writes on stdout, as it runs. This is useful to inspect backgrounded commands while alive.
+	// The function is called from a separate go routine, and should not block.
+	WithStdoutObserver(fun func(line string))
+	// WithStderrObserver does the same as WithStdoutObserver, for stderr.
+	WithStderrObserver(fun func(line string))
 	// Clone returns a copy of the command.
 	Clone() TestableCommand
 
@@ -101,10 +150,28 @@ type TestableCommand interface {
 	// An empty `&Expected{}` is (of course) equivalent to &Expected{Exit: 0}, meaning the command
 	// is verified to be successful.
 	Run(expect *Expected)
+	// RunEventually runs a clone of the command every interval, until its stdout satisfies until,
+	// or until deadline is reached - in which case the test fails. Expectations (if not nil) are
+	// only verified against the last attempt.
+	RunEventually(until func(stdout string) bool, expect *Expected, interval, deadline time.Duration)
 	// Background allows starting a command in the background.
+	// If it has not been Run (waited for) by the end of the test, it is terminated during cleanup,
+	// and its output logged if the test failed.
 	Background()
+	// WithReadiness makes Background block until one of the probes is satisfied (see ReadyOn*),
+	// failing the test if none is before timeout (default to 10 seconds), or if the command exits.
+	// Output passed to the probes is limited to the last WithOutputLimit bytes, if set.
+	WithReadiness(timeout time.Duration, probes ...ReadinessProbe)
+	// WithContext sets the context the command is run with (default to context.Background).
+	// Cancelling it terminates the command (see WithTimeoutEscalation), and can be verified with
+	// expect.ExitCodeCancelled.
+	WithContext(ctx context.Context)
 	// Signal sends a signal to a backgrounded command.
 	Signal(sig os.Signal) error
+	// Write writes to the stdin of a backgrounded command. It requires WithOpenStdin.
+	Write(data []byte) (int, error)
+	// CloseStdin ends the stdin of a backgrounded command. It requires WithOpenStdin.
+	CloseStdin() error
 	// Stderr allows retrieving the raw stderr output of the command once it has been run.
 	Stderr() string
 }
@@ -0,0 +1,370 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.farcloser.world/tigron/internal/assertive"
+	"go.farcloser.world/tigron/internal/com"
+)
+
+// pipelineStage is what a command needs to provide in order to be part of a pipeline.
+// GenericCommand (and anything embedding it) satisfies it.
+type pipelineStage interface {
+	TestableCommand
+
+	T() *testing.T
+	withStdio(stdin, stdout *os.File)
+	commandLine() string
+	execute() (*com.Result, error)
+	verify(t *testing.T, expect *Expected, result *com.Result, err error, note string)
+}
+
+// Pipeline connects the stdout of each command to the stdin of the next one, with OS pipes, and
+// runs them concurrently, like a shell would (`one | two | three`).
+// When Run, Expected applies to the last command. Expectations for the other commands can be set
+// with WithStageExpectation, and are otherwise not verified.
+// Commands must be GenericCommands (eg: obtained from helpers.Command or helpers.Custom).
+func Pipeline(stages ...TestableCommand) *PipelineCommand {
+	pipeline := &PipelineCommand{
+		expects: map[int]*Expected{},
+	}
+
+	for index, stage := range stages {
+		castStage, ok := stage.(pipelineStage)
+		if !ok {
+			panic(fmt.Sprintf("pipeline stage %d is not a GenericCommand", index))
+		}
+
+		pipeline.stages = append(pipeline.stages, castStage)
+	}
+
+	if len(pipeline.stages) == 0 {
+		panic("a pipeline needs at least one command")
+	}
+
+	return pipeline
+}
+
+// PipelineCommand is a TestableCommand made of several commands piped together.
+// Options that relate to stdin (Feed, WithFeeder, WithDialog, WithOpenStdin, Write, CloseStdin)
+// apply to the first command, options that relate to stdout (WithStdoutObserver, WithOutputLimit,
+// WithPTY, WithTerminalSize, Resize, WithReadiness) and WithBinary, WithArgs and WithWrapper apply
+// to the last one, and anything else to all of them.
+type PipelineCommand struct {
+	stages  []pipelineStage
+	expects map[int]*Expected
+	started bool
+}
+
+// WithStageExpectation sets expectations for the command at position index in the pipeline.
+func (pc *PipelineCommand) WithStageExpectation(index int, expect *Expected) *PipelineCommand {
+	pc.expects[index] = expect
+
+	return pc
+}
+
+func (pc *PipelineCommand) first() pipelineStage {
+	return pc.stages[0]
+}
+
+func (pc *PipelineCommand) last() pipelineStage {
+	return pc.stages[len(pc.stages)-1]
+}
+
+func (pc *PipelineCommand) WithBinary(binary string) {
+	pc.last().WithBinary(binary)
+}
+
+func (pc *PipelineCommand) WithArgs(args ...string) {
+	pc.last().WithArgs(args...)
+}
+
+func (pc *PipelineCommand) WithWrapper(binary string, args ...string) {
+	pc.last().WithWrapper(binary, args...)
+}
+
+func (pc *PipelineCommand) WithPseudoTTY() {
+	pc.last().WithPseudoTTY()
+}
+
+func (pc *PipelineCommand) WithPTY(stdin, stdout, stderr bool) {
+	pc.last().WithPTY(stdin, stdout, stderr)
+}
+
+func (pc *PipelineCommand) WithTerminalSize(rows, cols uint16) {
+	pc.last().WithTerminalSize(rows, cols)
+}
+
+func (pc *PipelineCommand) Resize(rows, cols uint16) error {
+	return pc.last().Resize(rows, cols)
+}
+
+func (pc *PipelineCommand) WithCwd(path string) {
+	for _, stage := range pc.stages {
+		stage.WithCwd(path)
+	}
+}
+
+func (pc *PipelineCommand) WithTimeout(timeout time.Duration) {
+	for _, stage := range pc.stages {
+		stage.WithTimeout(timeout)
+	}
+}
+
+func (pc *PipelineCommand) WithTimeoutEscalation(grace time.Duration, signals ...os.Signal) {
+	for _, stage := range pc.stages {
+		stage.WithTimeoutEscalation(grace, signals...)
+	}
+}
+
+func (pc *PipelineCommand) WithOrphanPolicy(policy OrphanPolicy) {
+	for _, stage := range pc.stages {
+		stage.WithOrphanPolicy(policy)
+	}
+}
+
+func (pc *PipelineCommand) WithSandbox() {
+	for _, stage := range pc.stages {
+		stage.WithSandbox()
+	}
+}
+
+func (pc *PipelineCommand) WithLimits(limits Limits) {
+	for _, stage := range pc.stages {
+		stage.WithLimits(limits)
+	}
+}
+
+func (pc *PipelineCommand) WithOutputLimit(size int64) {
+	pc.last().WithOutputLimit(size)
+}
+
+func (pc *PipelineCommand) Feed(r io.Reader) {
+	pc.first().Feed(r)
+}
+
+func (pc *PipelineCommand) WithFeeder(fun func() io.Reader) {
+	pc.first().WithFeeder(fun)
+}
+
+func (pc *PipelineCommand) WithDialog(steps ...*DialogStep) {
+	pc.first().WithDialog(steps...)
+}
+
+func (pc *PipelineCommand) WithReadiness(timeout time.Duration, probes ...ReadinessProbe) {
+	pc.last().WithReadiness(timeout, probes...)
+}
+
+func (pc *PipelineCommand) WithOpenStdin() {
+	pc.first().WithOpenStdin()
+}
+
+func (pc *PipelineCommand) WithStdoutObserver(fun func(line string)) {
+	pc.last().WithStdoutObserver(fun)
+}
+
+func (pc *PipelineCommand) WithStderrObserver(fun func(line string)) {
+	for _, stage := range pc.stages {
+		stage.WithStderrObserver(fun)
+	}
+}
+
+func (pc *PipelineCommand) WithContext(ctx context.Context) {
+	for _, stage := range pc.stages {
+		stage.WithContext(ctx)
+	}
+}
+
+func (pc *PipelineCommand) Clone() TestableCommand {
+	clone := &PipelineCommand{
+		expects: make(map[int]*Expected, len(pc.expects)),
+	}
+
+	for _, stage := range pc.stages {
+		//nolint:forcetypeassert // Clone of a pipeline stage is a pipeline stage
+		clone.stages = append(clone.stages, stage.Clone().(pipelineStage))
+	}
+
+	for index, expect := range pc.expects {
+		clone.expects[index] = expect
+	}
+
+	return clone
+}
+
+// Background starts all commands of the pipeline.
+func (pc *PipelineCommand) Background() {
+	if pc.started {
+		return
+	}
+
+	pc.started = true
+
+	var stdin *os.File
+
+	for index, stage := range pc.stages {
+		var reader, writer *os.File
+
+		if index < len(pc.stages)-1 {
+			var err error
+
+			reader, writer, err = os.Pipe()
+			assertive.ErrorIsNil(stage.T(), err, "Failed creating pipe for pipeline")
+		}
+
+		stage.withStdio(stdin, writer)
+		stage.Background()
+
+		// The commands hold their own copies now
+		if stdin != nil {
+			_ = stdin.Close()
+		}
+
+		if writer != nil {
+			_ = writer.Close()
+		}
+
+		stdin = reader
+	}
+}
+
+// Signal sends the signal to all commands of the pipeline.
+func (pc *PipelineCommand) Signal(sig os.Signal) error {
+	var errs []error
+
+	for _, stage := range pc.stages {
+		if err := stage.Signal(sig); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Write writes to the stdin of the first command of the pipeline.
+func (pc *PipelineCommand) Write(data []byte) (int, error) {
+	return pc.first().Write(data)
+}
+
+// CloseStdin ends the stdin of the first command of the pipeline.
+func (pc *PipelineCommand) CloseStdin() error {
+	return pc.first().CloseStdin()
+}
+
+// Stderr returns the stderr of the last command of the pipeline.
+func (pc *PipelineCommand) Stderr() string {
+	return pc.last().Stderr()
+}
+
+func (pc *PipelineCommand) Run(expect *Expected) {
+	if t := pc.last().T(); t != nil {
+		t.Helper()
+	}
+
+	results, errs := pc.execute()
+
+	pc.verify(expect, results, errs, "")
+}
+
+func (pc *PipelineCommand) RunEventually(
+	until func(stdout string) bool,
+	expect *Expected,
+	interval, deadline time.Duration,
+) {
+	if t := pc.last().T(); t != nil {
+		t.Helper()
+	}
+
+	limit := time.Now().Add(deadline)
+
+	for attempts := 1; ; attempts++ {
+		//nolint:forcetypeassert // Clone always returns a PipelineCommand
+		attempt := pc.Clone().(*PipelineCommand)
+		results, errs := attempt.execute()
+
+		met := until(results[len(results)-1].Stdout)
+
+		if met || time.Now().Add(interval).After(limit) {
+			// Verify the last attempt only
+			note := fmt.Sprintf("Attempts: %d (every %s, for %s)", attempts, interval, deadline)
+
+			assertive.True(pc.last().T(), met, "Condition was never met", note)
+
+			attempt.verify(expect, results, errs, note)
+
+			return
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// execute starts the pipeline (unless it was backgrounded), and waits for all commands.
+func (pc *PipelineCommand) execute() ([]*com.Result, []error) {
+	pc.Background()
+
+	results := make([]*com.Result, len(pc.stages))
+	errs := make([]error, len(pc.stages))
+
+	for index, stage := range pc.stages {
+		results[index], errs[index] = stage.execute()
+	}
+
+	return results, errs
+}
+
+func (pc *PipelineCommand) expectation(index int, expect *Expected) *Expected {
+	if index == len(pc.stages)-1 {
+		return expect
+	}
+
+	return pc.expects[index]
+}
+
+func (pc *PipelineCommand) verify(expect *Expected, results []*com.Result, errs []error, note string) {
+	if t := pc.last().T(); t != nil {
+		t.Helper()
+	}
+
+	// Describe the whole pipeline along each failure
+	summary := make([]string, 0, len(pc.stages))
+	for index, stage := range pc.stages {
+		summary = append(summary, fmt.Sprintf("|\t%d: %s\t(exit code: %d)",
+			index, stage.commandLine(), results[index].ExitCode))
+	}
+
+	pipelineNote := "Pipeline:\n" + strings.Join(summary, "\n")
+	if note != "" {
+		pipelineNote = note + "\n| " + pipelineNote
+	}
+
+	for index, stage := range pc.stages {
+		if stageExpect := pc.expectation(index, expect); stageExpect != nil {
+			stage.verify(stage.T(), stageExpect, results[index], errs[index],
+				fmt.Sprintf("Stage %d of %s", index, pipelineNote))
+		}
+	}
+}
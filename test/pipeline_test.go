@@ -0,0 +1,80 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+//nolint:testpackage // We need to test some internals here
+package test
+
+import (
+	"testing"
+
+	"go.farcloser.world/tigron/internal/assertive"
+)
+
+func equals(expected string) Comparator {
+	//nolint:thelper
+	return func(stdout, info string, t *testing.T) {
+		t.Helper()
+
+		assertive.IsEqual(t, stdout, expected, info)
+	}
+}
+
+//nolint:paralleltest // Case.Run takes care of it
+func TestPipeline(t *testing.T) {
+	testCase := &Case{
+		// Each stdout is connected to the next stdin
+		Command: func(_ Data, helpers Helpers) TestableCommand {
+			return Pipeline(
+				helpers.Custom("printf", "a\\nb\\n"),
+				helpers.Custom("tr", "ab", "ba"),
+				helpers.Custom("cat"),
+			).WithStageExpectation(0, &Expected{
+				// What a stage writes goes to the next one
+				Output: equals(""),
+			}).WithStageExpectation(1, &Expected{})
+		},
+		Expected: Expects(0, nil, equals("b\na\n")),
+	}
+
+	testCase.Run(t)
+}
+
+//nolint:paralleltest // Case.Run takes care of it
+func TestPipelineFailingStage(t *testing.T) {
+	testCase := &Case{
+		Setup: func(_ Data, helpers Helpers) {
+			verified := false
+
+			pipeline := Pipeline(
+				helpers.Custom("sh", "-c", "echo failing; exit 3"),
+				helpers.Custom("cat"),
+			).WithStageExpectation(0, &Expected{
+				ExitCode: 3,
+				//nolint:thelper
+				Output: func(_, _ string, _ *testing.T) {
+					verified = true
+				},
+			})
+
+			pipeline.Run(Expects(0, nil, equals("failing\n"))(nil, helpers))
+
+			assertive.True(helpers.T(), verified, "the failing stage should have been verified")
+		},
+	}
+
+	testCase.Run(t)
+}
@@ -0,0 +1,180 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.farcloser.world/tigron/internal/com"
+)
+
+const (
+	readinessInterval       = 100 * time.Millisecond
+	defaultReadinessTimeout = 10 * time.Second
+	dialTimeout             = time.Second
+)
+
+// A ReadinessProbe tells whether a backgrounded command is ready, provided with the output (stdout
+// and stderr) it produced so far (see TestableCommand.WithReadiness).
+// The context is cancelled once the readiness timeout expires, and probes that may block must
+// honor it.
+type ReadinessProbe func(ctx context.Context, output string) bool
+
+// ReadyOnOutput is satisfied once the output of the command matches the regular expression.
+func ReadyOnOutput(expr *regexp.Regexp) ReadinessProbe {
+	return func(_ context.Context, output string) bool {
+		return expr.MatchString(output)
+	}
+}
+
+// ReadyOnFile is satisfied once the file exists.
+func ReadyOnFile(path string) ReadinessProbe {
+	return func(_ context.Context, _ string) bool {
+		_, err := os.Stat(path)
+
+		return err == nil
+	}
+}
+
+// ReadyOnSocket is satisfied once the unix socket accepts connections.
+func ReadyOnSocket(path string) ReadinessProbe {
+	return dialProbe("unix", path)
+}
+
+// ReadyOnPort is satisfied once the TCP address (eg: "127.0.0.1:8080") accepts connections.
+func ReadyOnPort(address string) ReadinessProbe {
+	return dialProbe("tcp", address)
+}
+
+// ReadyOnCommand is satisfied once (a clone of) the command runs successfully.
+// The clone is cancelled if it is still running when the readiness timeout expires.
+func ReadyOnCommand(command TestableCommand) ReadinessProbe {
+	return func(ctx context.Context, _ string) bool {
+		probe, ok := command.Clone().(pipelineStage)
+		if !ok {
+			return false
+		}
+
+		probe.WithContext(ctx)
+
+		_, err := probe.execute()
+
+		return err == nil
+	}
+}
+
+func dialProbe(network, address string) ReadinessProbe {
+	return func(ctx context.Context, _ string) bool {
+		dialer := &net.Dialer{Timeout: dialTimeout}
+
+		conn, err := dialer.DialContext(ctx, network, address)
+		if err != nil {
+			return false
+		}
+
+		_ = conn.Close()
+
+		return true
+	}
+}
+
+// liveOutput accumulates the output of a command while it is running, until it is ready.
+// If limit is set, only the last limit bytes are kept.
+type liveOutput struct {
+	mutex   sync.Mutex
+	buffer  bytes.Buffer
+	limit   int64
+	stopped bool
+}
+
+func (lo *liveOutput) Write(data []byte) (int, error) {
+	lo.mutex.Lock()
+	defer lo.mutex.Unlock()
+
+	if lo.stopped {
+		return len(data), nil
+	}
+
+	lo.buffer.Write(data)
+
+	if excess := int64(lo.buffer.Len()) - lo.limit; lo.limit > 0 && excess > 0 {
+		lo.buffer.Next(int(excess))
+	}
+
+	return len(data), nil
+}
+
+func (lo *liveOutput) String() string {
+	lo.mutex.Lock()
+	defer lo.mutex.Unlock()
+
+	return lo.buffer.String()
+}
+
+// stop discards the output recorded so far, and anything written afterward.
+func (lo *liveOutput) stop() {
+	lo.mutex.Lock()
+	defer lo.mutex.Unlock()
+
+	lo.stopped = true
+	lo.buffer = bytes.Buffer{}
+}
+
+func (lo *liveOutput) provider() io.Writer {
+	return lo
+}
+
+// awaitReadiness polls the probes until one is satisfied, the command exits, or timeout expires.
+// Live output stops being recorded once it returns.
+func awaitReadiness(
+	cmd *com.Command,
+	live *liveOutput,
+	probes []ReadinessProbe,
+	timeout time.Duration,
+) bool {
+	defer live.stop()
+
+	// Probes are given the remainder of the timeout, so that none can hold Background past it
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(readinessInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, probe := range probes {
+			if probe(ctx, live.String()) {
+				return true
+			}
+		}
+
+		select {
+		case <-cmd.Exited():
+			return false
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
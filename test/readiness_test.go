@@ -0,0 +1,193 @@
+/*
+   Copyright Farcloser.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+//revive:disable:add-constant
+//nolint:testpackage // We need to test some internals here
+package test
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"go.farcloser.world/tigron/internal/assertive"
+)
+
+func TestReadyOnOutput(t *testing.T) {
+	t.Parallel()
+
+	probe := ReadyOnOutput(regexp.MustCompile(`listening on \d+`))
+
+	assertive.True(t, !probe(context.Background(), "starting\n"))
+	assertive.True(t, probe(context.Background(), "starting\nlistening on 8080\n"))
+}
+
+func TestReadyOnFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "ready")
+	probe := ReadyOnFile(path)
+
+	assertive.True(t, !probe(context.Background(), ""))
+
+	err := os.WriteFile(path, []byte{}, 0o600)
+	assertive.ErrorIsNil(t, err)
+
+	assertive.True(t, probe(context.Background(), ""))
+}
+
+func TestReadyOnSocket(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "ready.sock")
+	probe := ReadyOnSocket(path)
+
+	assertive.True(t, !probe(context.Background(), ""))
+
+	listener, err := net.Listen("unix", path)
+	assertive.ErrorIsNil(t, err)
+
+	assertive.True(t, probe(context.Background(), ""))
+
+	_ = listener.Close()
+}
+
+func TestReadyOnPort(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assertive.ErrorIsNil(t, err)
+
+	probe := ReadyOnPort(listener.Addr().String())
+
+	assertive.True(t, probe(context.Background(), ""))
+
+	_ = listener.Close()
+
+	assertive.True(t, !probe(context.Background(), ""))
+}
+
+//nolint:paralleltest // Case.Run takes care of it
+func TestReadyOnCommand(t *testing.T) {
+	testCase := &Case{
+		Setup: func(data Data, helpers Helpers) {
+			path := filepath.Join(data.TempDir(), "ready")
+			probe := ReadyOnCommand(helpers.Custom("cat", path))
+
+			assertive.True(helpers.T(), !probe(context.Background(), ""))
+
+			err := os.WriteFile(path, []byte{}, 0o600)
+			assertive.ErrorIsNil(helpers.T(), err)
+
+			assertive.True(helpers.T(), probe(context.Background(), ""))
+		},
+	}
+
+	testCase.Run(t)
+}
+
+//nolint:paralleltest // Case.Run takes care of it
+func TestReadyOnCommandDeadline(t *testing.T) {
+	testCase := &Case{
+		Setup: func(_ Data, helpers Helpers) {
+			command := helpers.Custom("sleep", "10")
+			command.WithTimeout(time.Minute)
+
+			probe := ReadyOnCommand(command)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+
+			// The probe gives up with the context, regardless of the timeout of the command
+			assertive.True(helpers.T(), !probe(ctx, ""))
+			assertive.DurationIsLessThan(helpers.T(), time.Since(start), 5*time.Second)
+		},
+	}
+
+	testCase.Run(t)
+}
+
+//nolint:paralleltest // Case.Run takes care of it
+func TestWithReadiness(t *testing.T) {
+	testCase := &Case{
+		Setup: func(_ Data, helpers Helpers) {
+			cmd := helpers.Custom("sh", "-c", "echo starting; sleep 1; echo ready; exec cat")
+			cmd.WithOpenStdin()
+			// Zero means the default timeout
+			cmd.WithReadiness(0, ReadyOnOutput(regexp.MustCompile("ready")))
+
+			start := time.Now()
+
+			cmd.Background()
+
+			assertive.True(helpers.T(), time.Since(start) > 500*time.Millisecond,
+				"Background should have waited for the command to be ready")
+
+			_, err := cmd.Write([]byte("done\n"))
+			assertive.ErrorIsNil(helpers.T(), err)
+
+			err = cmd.CloseStdin()
+			assertive.ErrorIsNil(helpers.T(), err)
+
+			cmd.Run(&Expected{
+				Output: equals("starting\nready\ndone\n"),
+			})
+		},
+	}
+
+	testCase.Run(t)
+}
+
+func TestClearReadiness(t *testing.T) {
+	t.Parallel()
+
+	cmd := NewGenericCommand()
+	cmd.WithReadiness(time.Second, ReadyOnOutput(regexp.MustCompile("ready")))
+
+	//nolint:forcetypeassert // clear always returns a GenericCommand
+	cleared := cmd.clear().(*GenericCommand)
+
+	// A fresh command does not inherit the readiness of the one it is made from
+	assertive.IsEqual(t, len(cleared.readiness), 0)
+	assertive.IsEqual(t, cleared.readinessTimeout, time.Duration(0))
+}
+
+func TestLiveOutput(t *testing.T) {
+	t.Parallel()
+
+	live := &liveOutput{limit: 8}
+
+	_, _ = live.Write([]byte("starting\n"))
+	_, _ = live.Write([]byte("ready"))
+
+	// Only the last bytes are kept
+	assertive.IsEqual(t, live.String(), "ng\nready")
+
+	// Nothing is recorded once stopped
+	live.stop()
+
+	count, err := live.Write([]byte("more"))
+
+	assertive.ErrorIsNil(t, err)
+	assertive.IsEqual(t, count, 4)
+	assertive.IsEqual(t, live.String(), "")
+}
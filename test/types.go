@@ -16,6 +16,12 @@
 
 package test
 
+import (
+	"os"
+	"regexp"
+	"time"
+)
+
 type (
 	// ConfigKey FIXME consider getting rid of this?
 	ConfigKey string
@@ -38,6 +44,36 @@ type Requirement struct {
 	Cleanup Butler
 }
 
+// OrphanPolicy defines what happens when a command leaves processes behind after exiting (linux
+// only).
+type OrphanPolicy int
+
+const (
+	// OrphanReport lists them in the debug output of a failing test, and leaves them alone.
+	OrphanReport OrphanPolicy = iota
+	// OrphanFail fails the test, and kills them.
+	OrphanFail
+	// OrphanKill kills them silently.
+	OrphanKill
+)
+
+// Limits are resource limits applied to a command (see TestableCommand.WithLimits). Zero leaves a
+// limit unchanged. They are set as hard limits, which the command cannot raise back, and which can
+// only lower the limits of the test.
+type Limits struct {
+	// OpenFiles is the maximum number of open file descriptors.
+	OpenFiles int64
+	// AddressSpace is the maximum size of the virtual memory of the command, in bytes.
+	AddressSpace int64
+	// CPUTime is the maximum CPU time (rounded up to the second), past which the command gets
+	// SIGXCPU.
+	CPUTime time.Duration
+	// CoreSize is the maximum size of core dumps, in bytes.
+	CoreSize int64
+	// Processes is the maximum number of processes of the user (not enforced for root).
+	Processes int64
+}
+
 // Expected expresses the expected output of a command.
 type Expected struct {
 	// ExitCode.
@@ -45,5 +81,35 @@ type Expected struct {
 	// Errors contains any error that (once serialized) should be seen in stderr.
 	Errors []error
 	// Output function to match against stdout.
+	// Note that if stdout exceeded the output limit of the command, only its beginning is passed
+	// along.
 	Output Comparator
+	// OutputStream function to match against the full stdout.
+	OutputStream StreamComparator
+	// MaxDuration, if set, is the wall-clock time the command must complete within.
+	MaxDuration time.Duration
+	// MaxCPUTime, if set, is the maximum user + system CPU time the command may consume.
+	MaxCPUTime time.Duration
+	// MaxMemory, if set, is the maximum peak resident set size (in bytes) of the command.
+	// It is ignored on platforms that do not report it (windows).
+	MaxMemory int64
+	// Signal, if set, is the signal that must have terminated the command (eg: syscall.SIGXCPU
+	// when exceeding Limits.CPUTime).
+	Signal os.Signal
+}
+
+// A DialogStep describes one exchange of a scripted conversation with a command (see
+// TestableCommand.WithDialog).
+type DialogStep struct {
+	// Expect is matched against the output produced since the previous step matched.
+	// If nil, Send is written right away.
+	Expect *regexp.Regexp
+	// Send is written to the command stdin once Expect has matched.
+	Send string
+	// Timeout is how long to wait for Expect to match (default to 5 seconds).
+	Timeout time.Duration
+	// Delay is how long to wait before writing Send.
+	Delay time.Duration
+	// Close ends stdin after Send has been written (with a pty, ^D is sent instead).
+	Close bool
 }